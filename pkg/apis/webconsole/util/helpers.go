@@ -16,6 +16,7 @@ func GetWebConsoleFileReferences(config *v1.WebConsoleConfiguration) []*string {
 		refs = append(refs, &config.ServingInfo.NamedCertificates[i].CertFile)
 		refs = append(refs, &config.ServingInfo.NamedCertificates[i].KeyFile)
 	}
+	refs = append(refs, &config.OAuthConfig.DiscoveryCAFile)
 
 	return refs
 }
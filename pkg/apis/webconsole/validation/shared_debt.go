@@ -47,6 +47,7 @@ func ValidateHTTPServingInfo(info v1.HTTPServingInfo, fldPath *field.Path) Valid
 	validationResults := ValidationResults{}
 
 	validationResults.Append(ValidateServingInfo(info.ServingInfo, true, fldPath))
+	validationResults.Append(ValidateACMEConfig(info.ACME, info.CertFile, fldPath.Child("acme")))
 
 	if info.MaxRequestsInFlight < 0 {
 		validationResults.AddErrors(field.Invalid(fldPath.Child("maxRequestsInFlight"), info.MaxRequestsInFlight, "must be zero (no limit) or greater"))
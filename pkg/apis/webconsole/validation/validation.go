@@ -1,6 +1,9 @@
 package validation
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -9,6 +12,15 @@ import (
 	"github.com/openshift/api/webconsole/v1"
 )
 
+// sriHashSizes maps each Subresource Integrity algorithm this server accepts to the raw
+// digest length (in bytes) it produces, so a hash expression's base64 can be checked against
+// it. See https://www.w3.org/TR/SRI/#the-integrity-attribute.
+var sriHashSizes = map[string]int{
+	"sha256": sha256.Size,
+	"sha384": sha512.Size384,
+	"sha512": sha512.Size,
+}
+
 // MinimumInactivityTimeoutMinutes defines the the smallest value allowed for InactivityTimeoutMinutes if not set to 0,
 // which disables the feature.
 const MinimumInactivityTimeoutMinutes = 5
@@ -21,6 +33,88 @@ func ValidateWebConsoleConfiguration(config *v1.WebConsoleConfiguration, fldPath
 	validationResults.Append(validateClusterInfo(config.ClusterInfo, fldPath.Child("clusterInfo")))
 	validationResults.Append(validateExtensions(config.Extensions, fldPath.Child("extensions")))
 	validationResults.Append(validateFeatures(config.Features, fldPath.Child("features")))
+	validationResults.Append(validateOAuth(config.OAuthConfig, fldPath.Child("oauthConfig")))
+
+	return validationResults
+}
+
+// validateOAuth validates the optional external OIDC issuer configuration. An unset
+// IssuerURL means the server continues to discover OAuth endpoints from the kube master,
+// so every other field in this block is only meaningful (and only validated) when it's set.
+func validateOAuth(config v1.OAuthConfig, fldPath *field.Path) ValidationResults {
+	validationResults := ValidationResults{}
+
+	if len(config.IssuerURL) == 0 {
+		return validationResults
+	}
+
+	if _, urlErrs := ValidateSecureURL(config.IssuerURL, fldPath.Child("issuerURL")); len(urlErrs) > 0 {
+		validationResults.AddErrors(urlErrs...)
+	}
+
+	if len(config.DiscoveryCAFile) > 0 {
+		validationResults.AddErrors(ValidateFile(config.DiscoveryCAFile, fldPath.Child("discoveryCAFile"))...)
+	}
+
+	if len(config.ClientID) == 0 {
+		validationResults.AddErrors(field.Required(fldPath.Child("clientID"), "required when issuerURL is set"))
+	}
+
+	if len(config.AuthorizationEndpoint) > 0 {
+		if _, urlErrs := ValidateSecureURL(config.AuthorizationEndpoint, fldPath.Child("authorizationEndpoint")); len(urlErrs) > 0 {
+			validationResults.AddErrors(urlErrs...)
+		}
+	}
+
+	if len(config.TokenEndpoint) > 0 {
+		if _, urlErrs := ValidateSecureURL(config.TokenEndpoint, fldPath.Child("tokenEndpoint")); len(urlErrs) > 0 {
+			validationResults.AddErrors(urlErrs...)
+		}
+	}
+
+	return validationResults
+}
+
+// ValidateACMEConfig validates the optional ACME (e.g. Let's Encrypt, ZeroSSL, step-ca)
+// certificate auto-provisioning configuration for a serving cert. A nil acmeConfig means the
+// operator is managing certFile/keyFile by hand, so there's nothing to validate.
+func ValidateACMEConfig(acmeConfig *v1.ACMEConfig, certFile string, fldPath *field.Path) ValidationResults {
+	validationResults := ValidationResults{}
+
+	if acmeConfig == nil {
+		return validationResults
+	}
+
+	if len(certFile) > 0 {
+		validationResults.AddErrors(field.Invalid(fldPath.Child("certFile"), certFile, "cannot specify both certFile and acme; acme provisions its own certificate for the configured hostnames"))
+	}
+
+	if len(acmeConfig.Email) == 0 {
+		validationResults.AddErrors(field.Required(fldPath.Child("email"), "required by most ACME certificate authorities to send expiry and policy notices"))
+	}
+
+	if len(acmeConfig.DirectoryURL) == 0 {
+		validationResults.AddErrors(field.Required(fldPath.Child("directoryURL"), ""))
+	} else if _, urlErrs := ValidateSecureURL(acmeConfig.DirectoryURL, fldPath.Child("directoryURL")); len(urlErrs) > 0 {
+		validationResults.AddErrors(urlErrs...)
+	}
+
+	if len(acmeConfig.CachePath) == 0 {
+		validationResults.AddErrors(field.Required(fldPath.Child("cachePath"), "required to persist issued certificates across restarts"))
+	}
+
+	if len(acmeConfig.Hostnames) == 0 {
+		validationResults.AddErrors(field.Required(fldPath.Child("hostnames"), ""))
+	}
+	for i, hostname := range acmeConfig.Hostnames {
+		if strings.HasPrefix(hostname, "*.") {
+			validationResults.AddWarnings(field.Invalid(fldPath.Child("hostnames").Index(i), hostname, "wildcard hostnames cannot be issued by the HTTP-01 or TLS-ALPN-01 challenge types used here"))
+		}
+	}
+
+	if (len(acmeConfig.EABKeyID) == 0) != (len(acmeConfig.EABHMAC) == 0) {
+		validationResults.AddErrors(field.Invalid(fldPath.Child("eabKeyID"), acmeConfig.EABKeyID, "eabKeyID and eabHMAC must be specified together or not at all"))
+	}
 
 	return validationResults
 }
@@ -90,6 +184,67 @@ func validateExtensions(config v1.ExtensionsConfiguration, fldPath *field.Path)
 		}
 	}
 
+	for i, script := range config.Scripts {
+		validationResults.Append(validateExtensionResource(script, fldPath.Child("scripts").Index(i+len(config.ScriptURLs))))
+	}
+
+	for i, stylesheet := range config.Stylesheets {
+		validationResults.Append(validateExtensionResource(stylesheet, fldPath.Child("stylesheets").Index(i+len(config.StylesheetURLs))))
+	}
+
+	return validationResults
+}
+
+// validateExtensionResource validates the structured {url, integrity, crossOrigin} form of
+// an extension script/stylesheet entry.
+func validateExtensionResource(resource v1.ExtensionResource, fldPath *field.Path) ValidationResults {
+	validationResults := ValidationResults{}
+
+	if _, urlErrs := ValidateSecureURL(resource.URL, fldPath.Child("url")); len(urlErrs) > 0 {
+		validationResults.AddErrors(urlErrs...)
+	}
+
+	if len(resource.Integrity) > 0 {
+		validationResults.Append(validateIntegrity(resource.Integrity, fldPath.Child("integrity")))
+	}
+
+	return validationResults
+}
+
+// validateIntegrity validates a Subresource Integrity attribute value: one or more
+// whitespace-separated "<algorithm>-<base64 digest>" hash expressions, per
+// https://www.w3.org/TR/SRI/#the-integrity-attribute. Each of sha256/sha384/sha512 may
+// appear at most once; a browser only ever checks the strongest hash present, so a repeated
+// algorithm can only be a copy-paste mistake.
+func validateIntegrity(integrity string, fldPath *field.Path) ValidationResults {
+	validationResults := ValidationResults{}
+
+	seenAlgorithms := map[string]bool{}
+	for _, hashExpression := range strings.Fields(integrity) {
+		separator := strings.Index(hashExpression, "-")
+		if separator < 0 {
+			validationResults.AddErrors(field.Invalid(fldPath, hashExpression, "must be a \"<algorithm>-<base64 digest>\" Subresource Integrity hash expression"))
+			continue
+		}
+		algorithm, digest := hashExpression[:separator], hashExpression[separator+1:]
+
+		expectedSize, ok := sriHashSizes[algorithm]
+		if !ok {
+			validationResults.AddErrors(field.Invalid(fldPath, hashExpression, "algorithm must be one of sha256, sha384, sha512"))
+			continue
+		}
+		if seenAlgorithms[algorithm] {
+			validationResults.AddErrors(field.Invalid(fldPath, hashExpression, fmt.Sprintf("must not specify the %s algorithm more than once", algorithm)))
+			continue
+		}
+		seenAlgorithms[algorithm] = true
+
+		decoded, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil || len(decoded) != expectedSize {
+			validationResults.AddErrors(field.Invalid(fldPath, hashExpression, fmt.Sprintf("must be a base64-encoded %s digest (%d bytes)", algorithm, expectedSize)))
+		}
+	}
+
 	return validationResults
 }
 
@@ -103,5 +258,67 @@ func validateFeatures(config v1.FeaturesConfiguration, fldPath *field.Path) Vali
 			fmt.Sprintf("the minimum acceptable inactivity timeout value is %d minutes", MinimumInactivityTimeoutMinutes)))
 	}
 
+	if len(config.ContentSecurityPolicy) > 0 {
+		validationResults.Append(ValidateCSP(config.ContentSecurityPolicy, fldPath.Child("contentSecurityPolicy")))
+	}
+
+	if len(config.StrictTransportSecurity) > 0 && !strings.Contains(config.StrictTransportSecurity, "max-age=") {
+		validationResults.AddErrors(field.Invalid(
+			fldPath.Child("strictTransportSecurity"), config.StrictTransportSecurity, "must set a max-age directive"))
+	}
+
+	if len(config.CrossOriginOpenerPolicy) > 0 {
+		validationResults.Append(validateOneOf(config.CrossOriginOpenerPolicy, fldPath.Child("crossOriginOpenerPolicy"),
+			"same-origin", "same-origin-allow-popups", "unsafe-none"))
+	}
+
+	if len(config.CrossOriginEmbedderPolicy) > 0 {
+		validationResults.Append(validateOneOf(config.CrossOriginEmbedderPolicy, fldPath.Child("crossOriginEmbedderPolicy"),
+			"require-corp", "credentialless", "unsafe-none"))
+	}
+
+	if len(config.ContentSecurityPolicyReportingEndpoint) > 0 {
+		if _, urlErrs := ValidateSecureURL(config.ContentSecurityPolicyReportingEndpoint, fldPath.Child("contentSecurityPolicyReportingEndpoint")); len(urlErrs) > 0 {
+			validationResults.AddErrors(urlErrs...)
+		}
+	}
+
+	return validationResults
+}
+
+// validateOneOf rejects value unless it's one of allowed, since these headers only have a
+// handful of valid directives and a typo would otherwise silently fall back to the browser
+// default instead of failing config validation.
+func validateOneOf(value string, fldPath *field.Path, allowed ...string) ValidationResults {
+	validationResults := ValidationResults{}
+
+	for _, candidate := range allowed {
+		if value == candidate {
+			return validationResults
+		}
+	}
+
+	validationResults.AddErrors(field.Invalid(fldPath, value, fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))))
+	return validationResults
+}
+
+// ValidateCSP rejects a configured Content-Security-Policy that would either fail to protect
+// against script/style injection or fail to render, since a broken policy on this field takes
+// down the whole console rather than degrading gracefully.
+func ValidateCSP(policy string, fldPath *field.Path) ValidationResults {
+	validationResults := ValidationResults{}
+
+	if !strings.Contains(policy, "default-src") {
+		validationResults.AddErrors(field.Invalid(fldPath, policy, "must set a default-src directive"))
+	}
+
+	if !strings.Contains(policy, "{{nonce}}") {
+		validationResults.AddErrors(field.Invalid(fldPath, policy, "script-src and style-src must include the 'nonce-{{nonce}}' placeholder so inline scripts/styles keep working"))
+	}
+
+	if strings.Contains(policy, "'unsafe-inline'") {
+		validationResults.AddErrors(field.Invalid(fldPath, policy, "'unsafe-inline' defeats the purpose of the per-response nonce and must not be used"))
+	}
+
 	return validationResults
 }
@@ -15,19 +15,22 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	genericapifilters "k8s.io/apiserver/pkg/endpoints/filters"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
-	"k8s.io/apiserver/pkg/features"
 	"k8s.io/apiserver/pkg/server"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericfilters "k8s.io/apiserver/pkg/server/filters"
 	genericmux "k8s.io/apiserver/pkg/server/mux"
-	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/kubernetes"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	"github.com/openshift/api/webconsole/v1"
+	"github.com/openshift/origin-web-console-server/pkg/apis/webconsole/validation"
 	"github.com/openshift/origin-web-console-server/pkg/assets"
 	"github.com/openshift/origin-web-console-server/pkg/assets/java"
+	"github.com/openshift/origin-web-console-server/pkg/assets/metrics"
 	builtversion "github.com/openshift/origin-web-console-server/pkg/version"
 )
 
@@ -62,6 +65,15 @@ const (
 	// See IETF Draft:
 	// https://tools.ietf.org/html/draft-ietf-oauth-discovery-04#section-2
 	oauthMetadataEndpoint = "/.well-known/oauth-authorization-server"
+
+	// Discovery endpoint for the console's own public URLs, published by the master so
+	// components like the oauth-server and CLI login flows don't need ConsolePublicURL
+	// statically configured.
+	consoleConfigurationMetadataEndpoint = "/.well-known/console-configuration"
+
+	// cspReportEndpoint is where browsers POST Content-Security-Policy violation reports
+	// when Features.ContentSecurityPolicyReportingEndpoint is configured to point at it.
+	cspReportEndpoint = "/csp-report"
 )
 
 type ExtraConfig struct {
@@ -70,6 +82,17 @@ type ExtraConfig struct {
 
 	OAuthAuthorizationEndpoint string
 	OAuthTokenEndpoint         string
+	// OAuthJWKSURI and OAuthEndSessionEndpoint are only populated when
+	// OAuthDiscoverySource is "oidc-issuer"; the kube master's OAuth 2.0 Authorization
+	// Server Metadata endpoint doesn't publish them.
+	OAuthJWKSURI            string
+	OAuthEndSessionEndpoint string
+	// OAuthClientID is OAuthConfig.ClientID when an external OIDC issuer is configured,
+	// or OpenShiftWebConsoleClientID otherwise.
+	OAuthClientID string
+	// OAuthDiscoverySource is "master" or "oidc-issuer", recording where
+	// OAuthAuthorizationEndpoint/OAuthTokenEndpoint were discovered from.
+	OAuthDiscoverySource string
 }
 
 type AssetServerConfig struct {
@@ -82,6 +105,24 @@ type AssetServer struct {
 	GenericAPIServer *genericapiserver.GenericAPIServer
 
 	PublicURL url.URL
+
+	// oauthEndpoints and oauthClientID hold the values discovered/resolved during
+	// Complete() (from discovery and the startup OAuthConfig); ReloadWebConsoleConfig
+	// carries them forward unchanged rather than re-resolving them.
+	oauthEndpoints       OAuthAuthorizationServerMetadata
+	oauthClientID        string
+	oauthDiscoverySource string
+
+	// configHandler serves config.js and configJSONHandler serves the config.json companion
+	// endpoint; both can be swapped out by ReloadWebConsoleConfig without requiring a
+	// restart.
+	configHandler     *reloadableHandler
+	configJSONHandler *reloadableHandler
+
+	// assetHandler serves the console's static assets and index.html, and is rebuilt and
+	// swapped by ReloadWebConsoleConfig whenever Extensions changes, so an updated
+	// ScriptURLs/StylesheetURLs list reaches index.html without a restart.
+	assetHandler *reloadableHandler
 }
 
 type completedConfig struct {
@@ -97,6 +138,20 @@ type CompletedConfig struct {
 type OAuthAuthorizationServerMetadata struct {
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
+	// JWKSURI and EndSessionEndpoint are only populated when the endpoints are sourced
+	// from an external OIDC issuer (OAuthConfig.IssuerURL); the master's OAuth 2.0
+	// Authorization Server Metadata endpoint doesn't publish them.
+	JWKSURI            string `json:"jwks_uri,omitempty"`
+	EndSessionEndpoint string `json:"end_session_endpoint,omitempty"`
+}
+
+// ConsoleConfigurationMetadata is published by the master at consoleConfigurationMetadataEndpoint
+// and discovered by Complete() to fill in ClusterInfo values the operator didn't set explicitly.
+type ConsoleConfigurationMetadata struct {
+	ConsolePublicURL string `json:"console_public_url"`
+	LogoutPublicURL  string `json:"logout_public_url,omitempty"`
+	LoggingPublicURL string `json:"logging_public_url,omitempty"`
+	MetricsPublicURL string `json:"metrics_public_url,omitempty"`
 }
 
 func NewAssetServerConfig(config v1.WebConsoleConfiguration) (*AssetServerConfig, error) {
@@ -131,25 +186,85 @@ func (c *AssetServerConfig) Complete() (completedConfig, error) {
 		return completedConfig{}, err
 	}
 
-	// Discover the published OAuth endpoints from the well-known URL.
-	resultBytes, err := restClient.RESTClient().Get().AbsPath(oauthMetadataEndpoint).Do().Raw()
+	// Discover the OAuth endpoints, either from the kube master's well-known URL or, if
+	// OAuthConfig.IssuerURL is set, from that external OIDC issuer's own discovery document.
+	metadata, clientID, discoverySource, err := resolveOAuthEndpoints(restClient, cfg.ExtraConfig.Options)
 	if err != nil {
+		metrics.OAuthDiscoveryFailureCount.Inc()
 		return completedConfig{}, err
 	}
-	metadata := &OAuthAuthorizationServerMetadata{}
-	if err := json.Unmarshal(resultBytes, metadata); err != nil {
+	cfg.ExtraConfig.OAuthAuthorizationEndpoint = metadata.AuthorizationEndpoint
+	cfg.ExtraConfig.OAuthTokenEndpoint = metadata.TokenEndpoint
+	cfg.ExtraConfig.OAuthJWKSURI = metadata.JWKSURI
+	cfg.ExtraConfig.OAuthEndSessionEndpoint = metadata.EndSessionEndpoint
+	cfg.ExtraConfig.OAuthClientID = clientID
+	cfg.ExtraConfig.OAuthDiscoverySource = discoverySource
+
+	// Discover the console's public URLs, falling back to this only for values that
+	// weren't explicitly set in the config file.
+	if err := discoverConsoleConfigurationMetadata(restClient, &cfg.ExtraConfig.Options.ClusterInfo); err != nil {
+		metrics.OAuthDiscoveryFailureCount.Inc()
 		return completedConfig{}, err
 	}
-	if len(metadata.AuthorizationEndpoint) == 0 || len(metadata.TokenEndpoint) == 0 {
-		err := fmt.Errorf("authorization or token endpoint missing from OAuth authorization server metadata (authorization endpoint: %q, token endpoint: %q)", metadata.AuthorizationEndpoint, metadata.TokenEndpoint)
+	publicURL, err := url.Parse(cfg.ExtraConfig.Options.ClusterInfo.ConsolePublicURL)
+	if err != nil {
 		return completedConfig{}, err
 	}
-	cfg.ExtraConfig.OAuthAuthorizationEndpoint = metadata.AuthorizationEndpoint
-	cfg.ExtraConfig.OAuthTokenEndpoint = metadata.TokenEndpoint
+	cfg.ExtraConfig.PublicURL = *publicURL
 
 	return cfg, nil
 }
 
+// discoverConsoleConfigurationMetadata fills in any of clusterInfo's public URLs that were
+// left unset in the config file by querying the master's well-known console-configuration
+// endpoint. Discovery is skipped when every value is already set explicitly, and a failed
+// request to the endpoint is tolerated as long as ConsolePublicURL is set, so clusters
+// without the endpoint keep working with a static configuration.
+func discoverConsoleConfigurationMetadata(restClient *kubernetes.Clientset, clusterInfo *v1.ClusterInfo) error {
+	if len(clusterInfo.ConsolePublicURL) > 0 && len(clusterInfo.LogoutPublicURL) > 0 &&
+		len(clusterInfo.LoggingPublicURL) > 0 && len(clusterInfo.MetricsPublicURL) > 0 {
+		return nil
+	}
+
+	resultBytes, err := restClient.RESTClient().Get().AbsPath(consoleConfigurationMetadataEndpoint).Do().Raw()
+	if err != nil {
+		if len(clusterInfo.ConsolePublicURL) > 0 {
+			// We have enough to run; the endpoint is simply unavailable on this master.
+			return nil
+		}
+		return fmt.Errorf("consolePublicURL was not set and console configuration metadata could not be discovered: %v", err)
+	}
+
+	metadata := &ConsoleConfigurationMetadata{}
+	if err := json.Unmarshal(resultBytes, metadata); err != nil {
+		return fmt.Errorf("error parsing discovered console configuration metadata: %v", err)
+	}
+
+	for _, discovered := range []struct {
+		value   string
+		current *string
+	}{
+		{metadata.ConsolePublicURL, &clusterInfo.ConsolePublicURL},
+		{metadata.LogoutPublicURL, &clusterInfo.LogoutPublicURL},
+		{metadata.LoggingPublicURL, &clusterInfo.LoggingPublicURL},
+		{metadata.MetricsPublicURL, &clusterInfo.MetricsPublicURL},
+	} {
+		if len(*discovered.current) > 0 || len(discovered.value) == 0 {
+			continue
+		}
+		if _, urlErrs := validation.ValidateSecureURL(discovered.value, field.NewPath("discoveredConsoleConfiguration")); len(urlErrs) > 0 {
+			return fmt.Errorf("discovered console configuration metadata was invalid: %v", urlErrs.ToAggregate())
+		}
+		*discovered.current = discovered.value
+	}
+
+	if len(clusterInfo.ConsolePublicURL) == 0 {
+		return fmt.Errorf("consolePublicURL was not set and could not be discovered from console configuration metadata")
+	}
+
+	return nil
+}
+
 func (c completedConfig) New(delegationTarget genericapiserver.DelegationTarget) (*AssetServer, error) {
 	genericServer, err := c.GenericConfig.New("origin-web-console-server", delegationTarget)
 	if err != nil {
@@ -161,23 +276,127 @@ func (c completedConfig) New(delegationTarget genericapiserver.DelegationTarget)
 		PublicURL:        c.ExtraConfig.PublicURL,
 	}
 
-	if err := c.addAssets(s.GenericAPIServer.Handler.NonGoRestfulMux); err != nil {
+	s.oauthEndpoints = OAuthAuthorizationServerMetadata{
+		AuthorizationEndpoint: c.ExtraConfig.OAuthAuthorizationEndpoint,
+		TokenEndpoint:         c.ExtraConfig.OAuthTokenEndpoint,
+		JWKSURI:               c.ExtraConfig.OAuthJWKSURI,
+		EndSessionEndpoint:    c.ExtraConfig.OAuthEndSessionEndpoint,
+	}
+	s.oauthClientID = c.ExtraConfig.OAuthClientID
+	s.oauthDiscoverySource = c.ExtraConfig.OAuthDiscoverySource
+
+	assetHandler, err := c.addAssets(s.GenericAPIServer.Handler.NonGoRestfulMux)
+	if err != nil {
 		return nil, err
 	}
-	if err := c.addWebConsoleConfig(s.GenericAPIServer.Handler.NonGoRestfulMux); err != nil {
+	s.assetHandler = assetHandler
+
+	configHandler, configJSONHandler, err := c.addWebConsoleConfig(s.GenericAPIServer.Handler.NonGoRestfulMux)
+	if err != nil {
 		return nil, err
 	}
+	s.configHandler = configHandler
+	s.configJSONHandler = configJSONHandler
+
+	c.addConsoleConfigurationMetadata(s.GenericAPIServer.Handler.NonGoRestfulMux)
+	c.addMetrics(s.GenericAPIServer.Handler.NonGoRestfulMux)
+	c.addCSPReportEndpoint(s.GenericAPIServer.Handler.NonGoRestfulMux)
 
 	return s, nil
 }
 
+// addCSPReportEndpoint mounts assets.CSPReportHandler at cspReportEndpoint, gated by
+// Features.ContentSecurityPolicyReportingEndpoint being set, since there's no point handling
+// reports nothing is configured to send here. Reports arrive unauthenticated, straight from
+// the browser that hit the violation, the same way consoleConfigurationMetadataEndpoint is
+// reachable without credentials (unlike /metrics, which addMetrics puts behind authn/authz).
+func (c completedConfig) addCSPReportEndpoint(serverMux *genericmux.PathRecorderMux) {
+	if len(c.ExtraConfig.Options.Features.ContentSecurityPolicyReportingEndpoint) == 0 {
+		return
+	}
+
+	sink := assets.MultiReportSink{assets.LogReportSink{}, assets.MetricsReportSink{}}
+	serverMux.UnlistedHandle(cspReportEndpoint, assets.CSPReportHandler(sink))
+}
+
+// addMetrics installs the Prometheus handler at an unlisted /metrics path, gated by
+// Features.EnableMetrics. Scrapes are authenticated/authorized the same way the generic
+// apiserver protects its own /metrics endpoint, so only callers with get access to the
+// nonResourceURL can read them.
+func (c completedConfig) addMetrics(serverMux *genericmux.PathRecorderMux) {
+	if !c.ExtraConfig.Options.Features.EnableMetrics {
+		return
+	}
+
+	handler := genericapifilters.WithAuthorization(promhttp.Handler(), c.GenericConfig.Authorization.Authorizer, codecs)
+	handler = genericapifilters.WithAuthentication(handler, c.GenericConfig.Authentication.Authenticator, http.HandlerFunc(unauthorizedHandler), nil)
+
+	serverMux.UnlistedHandle("/metrics", handler)
+}
+
+func unauthorizedHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// addConsoleConfigurationMetadata publishes the effective (post-discovery) ClusterInfo
+// public URLs at consoleConfigurationMetadataEndpoint, so other components (and other
+// instances of this server) can discover them the same way Complete() does.
+func (c completedConfig) addConsoleConfigurationMetadata(serverMux *genericmux.PathRecorderMux) {
+	metadata := ConsoleConfigurationMetadata{
+		ConsolePublicURL: c.ExtraConfig.Options.ClusterInfo.ConsolePublicURL,
+		LogoutPublicURL:  c.ExtraConfig.Options.ClusterInfo.LogoutPublicURL,
+		LoggingPublicURL: c.ExtraConfig.Options.ClusterInfo.LoggingPublicURL,
+		MetricsPublicURL: c.ExtraConfig.Options.ClusterInfo.MetricsPublicURL,
+	}
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		// metadata only contains strings, this can't fail
+		panic(err)
+	}
+
+	serverMux.UnlistedHandle(consoleConfigurationMetadataEndpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}))
+}
+
+// ReloadWebConsoleConfig regenerates the config.js/config.json handlers and the asset/
+// index.html handler from options and atomically swaps them in, so operators can pick up
+// ConsolePublicURL, feature toggles, and extension script/stylesheet changes without
+// restarting the pod. It does not affect the OAuth endpoints or client ID resolved during
+// Complete(), so a changed OAuthConfig in the reloaded file has no effect until restart.
+//
+// It also does not reload the serving certificates itself: that's handled alongside it, not
+// inside it, by WebConsoleServerOptions.RunWebConsoleServer's onReload, which additionally
+// reloads ServingInfo.CertFile/KeyFile/NamedCertificates into a reload.CertificateStore on
+// the same trigger when one was wired in (static cert/key, as opposed to ACME, which renews
+// itself independently).
+func (s *AssetServer) ReloadWebConsoleConfig(options v1.WebConsoleConfiguration) error {
+	handler, jsonHandler, err := buildWebConsoleConfigHandlers(options, s.oauthEndpoints, s.oauthClientID, s.oauthDiscoverySource)
+	if err != nil {
+		return err
+	}
+	assetHandler, err := buildAssetHandler(options, s.PublicURL.Path)
+	if err != nil {
+		return err
+	}
+	s.configHandler.Set(handler)
+	s.configJSONHandler.Set(jsonHandler)
+	s.assetHandler.Set(assetHandler)
+	return nil
+}
+
 // buildHandlerChainForAssets is the handling chain used to protect the asset server.  With no secret information to protect
 // the chain is very short.
 func buildHandlerChainForAssets(consoleRedirectPath string) func(startingHandler http.Handler, c *genericapiserver.Config) http.Handler {
 	return func(startingHandler http.Handler, c *genericapiserver.Config) http.Handler {
 		handler := WithAssetServerRedirect(startingHandler, consoleRedirectPath)
 		handler = genericfilters.WithMaxInFlightLimit(handler, c.MaxRequestsInFlight, c.MaxMutatingRequestsInFlight, c.RequestContextMapper, c.LongRunningFunc)
-		if utilfeature.DefaultFeatureGate.Enabled(features.AdvancedAuditing) {
+		// Unlike the generic apiserver default, install the audit filter whenever a
+		// backend is configured, not only behind the AdvancedAuditing feature gate --
+		// asset/config.js requests carry no secrets, so there's no reason to withhold
+		// auditing of them pending that gate's general availability.
+		if c.AuditBackend != nil {
 			handler = genericapifilters.WithAudit(handler, c.RequestContextMapper, c.AuditBackend, c.AuditPolicyChecker, c.LongRunningFunc)
 		}
 		handler = genericfilters.WithCORS(handler, c.CorsAllowedOriginList, nil, nil, nil, "true")
@@ -190,21 +409,53 @@ func buildHandlerChainForAssets(consoleRedirectPath string) func(startingHandler
 	}
 }
 
-func (c completedConfig) addAssets(serverMux *genericmux.PathRecorderMux) error {
-	assetHandler, err := c.buildAssetHandler()
+// addAssets mounts the asset handler behind a reloadableHandler, so ReloadWebConsoleConfig can
+// swap in a handler rebuilt from a reloaded Extensions config (new ScriptURLs/StylesheetURLs)
+// without restarting the pod, the same way it already does for configHandler/configJSONHandler.
+func (c completedConfig) addAssets(serverMux *genericmux.PathRecorderMux) (*reloadableHandler, error) {
+	assetHandler, err := buildAssetHandler(c.ExtraConfig.Options, c.ExtraConfig.PublicURL.Path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	serverMux.UnlistedHandlePrefix(c.ExtraConfig.PublicURL.Path, http.StripPrefix(c.ExtraConfig.PublicURL.Path, assetHandler))
+	reloadable := newReloadableHandler(assetHandler)
+	serverMux.UnlistedHandlePrefix(c.ExtraConfig.PublicURL.Path, http.StripPrefix(c.ExtraConfig.PublicURL.Path, reloadable))
 	serverMux.UnlistedHandle(c.ExtraConfig.PublicURL.Path[0:len(c.ExtraConfig.PublicURL.Path)-1], http.RedirectHandler(c.ExtraConfig.PublicURL.Path, http.StatusMovedPermanently))
-	return nil
+	return reloadable, nil
 }
 
-func (c *completedConfig) addWebConsoleConfig(serverMux *genericmux.PathRecorderMux) error {
-	masterURL, err := url.Parse(c.ExtraConfig.Options.ClusterInfo.MasterPublicURL)
+func (c *completedConfig) addWebConsoleConfig(serverMux *genericmux.PathRecorderMux) (*reloadableHandler, *reloadableHandler, error) {
+	oauthEndpoints := OAuthAuthorizationServerMetadata{
+		AuthorizationEndpoint: c.ExtraConfig.OAuthAuthorizationEndpoint,
+		TokenEndpoint:         c.ExtraConfig.OAuthTokenEndpoint,
+		JWKSURI:               c.ExtraConfig.OAuthJWKSURI,
+		EndSessionEndpoint:    c.ExtraConfig.OAuthEndSessionEndpoint,
+	}
+	configHandler, configJSONHandler, err := buildWebConsoleConfigHandlers(c.ExtraConfig.Options, oauthEndpoints, c.ExtraConfig.OAuthClientID, c.ExtraConfig.OAuthDiscoverySource)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	reloadable := newReloadableHandler(configHandler)
+	configPath := path.Join(c.ExtraConfig.PublicURL.Path, "config.js")
+	serverMux.UnlistedHandle(configPath, reloadable)
+
+	reloadableJSON := newReloadableHandler(configJSONHandler)
+	configJSONPath := path.Join(c.ExtraConfig.PublicURL.Path, "config.json")
+	serverMux.UnlistedHandle(configJSONPath, reloadableJSON)
+
+	return reloadable, reloadableJSON, nil
+}
+
+// buildWebConsoleConfigHandlers generates the gzip'd, security-headered config.js and
+// config.json handlers for the given options. oauthEndpoints and oauthClientID are threaded
+// through separately because they are resolved once, by OAuth discovery in Complete(), not
+// re-read from options, so a config reload carries them forward unchanged instead of
+// re-discovering them.
+func buildWebConsoleConfigHandlers(options v1.WebConsoleConfiguration, oauthEndpoints OAuthAuthorizationServerMetadata, oauthClientID, oauthDiscoverySource string) (http.Handler, http.Handler, error) {
+	masterURL, err := url.Parse(options.ClusterInfo.MasterPublicURL)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Generated web console config and server version
@@ -215,16 +466,19 @@ func (c *completedConfig) addWebConsoleConfig(serverMux *genericmux.PathRecorder
 		MasterPrefix:                    "/oapi",
 		KubernetesAddr:                  masterURL.Host,
 		KubernetesPrefix:                server.DefaultLegacyAPIPrefix,
-		OAuthAuthorizeURI:               c.ExtraConfig.OAuthAuthorizationEndpoint,
-		OAuthTokenURI:                   c.ExtraConfig.OAuthTokenEndpoint,
-		OAuthRedirectBase:               c.ExtraConfig.Options.ClusterInfo.ConsolePublicURL,
-		OAuthClientID:                   OpenShiftWebConsoleClientID,
-		LogoutURI:                       c.ExtraConfig.Options.ClusterInfo.LogoutPublicURL,
-		LoggingURL:                      c.ExtraConfig.Options.ClusterInfo.LoggingPublicURL,
-		MetricsURL:                      c.ExtraConfig.Options.ClusterInfo.MetricsPublicURL,
-		InactivityTimeoutMinutes:        c.ExtraConfig.Options.Features.InactivityTimeoutMinutes,
-		ClusterResourceOverridesEnabled: c.ExtraConfig.Options.Features.ClusterResourceOverridesEnabled,
-		AdminConsoleURL:                 c.ExtraConfig.Options.ClusterInfo.AdminConsolePublicURL,
+		OAuthAuthorizeURI:               oauthEndpoints.AuthorizationEndpoint,
+		OAuthTokenURI:                   oauthEndpoints.TokenEndpoint,
+		OAuthJWKSURI:                    oauthEndpoints.JWKSURI,
+		OAuthEndSessionEndpoint:         oauthEndpoints.EndSessionEndpoint,
+		OAuthRedirectBase:               options.ClusterInfo.ConsolePublicURL,
+		OAuthClientID:                   oauthClientID,
+		LogoutURI:                       options.ClusterInfo.LogoutPublicURL,
+		LoggingURL:                      options.ClusterInfo.LoggingPublicURL,
+		MetricsURL:                      options.ClusterInfo.MetricsPublicURL,
+		InactivityTimeoutMinutes:        options.Features.InactivityTimeoutMinutes,
+		ClusterResourceOverridesEnabled: options.Features.ClusterResourceOverridesEnabled,
+		AdminConsoleURL:                 options.ClusterInfo.AdminConsolePublicURL,
+		OAuthDiscoverySource:            oauthDiscoverySource,
 	}
 
 	versionInfo := assets.WebConsoleVersion{
@@ -232,20 +486,35 @@ func (c *completedConfig) addWebConsoleConfig(serverMux *genericmux.PathRecorder
 	}
 
 	extensionProps := assets.WebConsoleExtensionProperties{
-		ExtensionProperties: extensionPropertyArray(c.ExtraConfig.Options.Extensions.Properties),
+		ExtensionProperties: extensionPropertyArray(options.Extensions.Properties),
 	}
-	configPath := path.Join(c.ExtraConfig.PublicURL.Path, "config.js")
-	configHandler, err := assets.GeneratedConfigHandler(config, versionInfo, extensionProps)
-	configHandler = assets.SecurityHeadersHandler(configHandler)
+
+	cspTemplate := contentSecurityPolicyTemplate(
+		options,
+		extensionResourceArray(options.Extensions.ScriptURLs, options.Extensions.Scripts),
+		extensionResourceArray(options.Extensions.StylesheetURLs, options.Extensions.Stylesheets),
+	)
+
+	configHandler, err := assets.GeneratedConfigHandler(config, versionInfo, extensionProps, cspTemplate)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	serverMux.UnlistedHandle(configPath, assets.GzipHandler(configHandler))
+	configHandler = assets.SecurityHeadersHandler(securityHeadersConfig(options), configHandler)
 
-	return nil
+	configJSONHandler, err := assets.GeneratedConfigJSONHandler(config, versionInfo, extensionProps, cspTemplate)
+	if err != nil {
+		return nil, nil, err
+	}
+	configJSONHandler = assets.SecurityHeadersHandler(securityHeadersConfig(options), configJSONHandler)
+
+	return assets.GzipHandler(configHandler), assets.GzipHandler(configJSONHandler), nil
 }
 
-func (c completedConfig) buildAssetHandler() (http.Handler, error) {
+// buildAssetHandler takes options and publicURLPath rather than reading them off completedConfig
+// so ReloadWebConsoleConfig can rebuild the handler from a freshly reloaded configuration
+// without a full completedConfig to hand: publicURLPath, unlike options, never changes after
+// startup, so the reload path reuses the one AssetServer was built with.
+func buildAssetHandler(options v1.WebConsoleConfiguration, publicURLPath string) (http.Handler, error) {
 	assets.RegisterMimeTypes()
 
 	assetFunc := assets.JoinAssetFuncs(assets.Asset, java.Asset)
@@ -262,29 +531,171 @@ func (c completedConfig) buildAssetHandler() (http.Handler, error) {
 	var err error
 	version := builtversion.Get().GitCommit
 
+	scripts := extensionResourceArray(options.Extensions.ScriptURLs, options.Extensions.Scripts)
+	stylesheets := extensionResourceArray(options.Extensions.StylesheetURLs, options.Extensions.Stylesheets)
+
+	// Built once up front, since HTML5ModeHandler also uses it to give bundled assets a
+	// strong, content-derived ETag instead of the weak version-derived one it falls back to
+	// for dynamic content. subcontextMap's index targets are excluded: they're the dynamic,
+	// per-request index.html HTML5ModeHandler rewrites (extension tags, CSP nonce, ETag) on
+	// every request, not immutable fingerprinted bundles, so they must keep the weak,
+	// version-derived ETag and must-revalidate treatment instead of being served byte-for-byte
+	// out of this cache.
+	assetNames := assets.JoinAssetNamesFuncs(assets.AssetNames, java.AssetNames)
+	cacheableAssetNames := make([]string, 0, len(assetNames))
+	for _, name := range assetNames {
+		if isIndexTarget(subcontextMap, name) {
+			continue
+		}
+		cacheableAssetNames = append(cacheableAssetNames, name)
+	}
+	precompressedCache, err := assets.BuildPrecompressedAssetCache(assetFunc, cacheableAssetNames)
+	if err != nil {
+		return nil, err
+	}
+
 	// This handler must be in the chain after GzipHandler so that GzipHandler can add the Vary
 	// response header first. ETags should be different when the response uses gzip.
 	handler, err = assets.HTML5ModeHandler(
-		c.ExtraConfig.PublicURL.Path,
+		publicURLPath,
 		subcontextMap,
-		c.ExtraConfig.Options.Extensions.ScriptURLs,
-		c.ExtraConfig.Options.Extensions.StylesheetURLs,
+		scripts,
+		stylesheets,
 		version,
 		handler,
 		assetFunc,
+		contentSecurityPolicyTemplate(options, scripts, stylesheets),
+		precompressedCache,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	handler = assets.SecurityHeadersHandler(handler)
-
 	// Gzip first so that inner handlers can react to the addition of the Vary header
 	handler = assets.GzipHandler(handler)
 
+	// Serve precompressed bindata bundles directly when the client's Accept-Encoding allows
+	// it, rather than burning CPU recompressing the same immutable bundle on every request.
+	// Falls back to the on-the-fly GzipHandler above for anything it can't satisfy, such as
+	// the dynamically rendered index.html fallback.
+	handler = assets.PrecompressedAssetHandler(precompressedCache, handler)
+
+	// Must wrap PrecompressedAssetHandler, not just HTML5ModeHandler: on a cache hit,
+	// PrecompressedAssetHandler writes the response and returns without calling its inner
+	// handler, so a SecurityHeadersHandler installed only further in would never run for the
+	// common case of a bundled JS/CSS/font request from a client advertising gzip/br.
+	handler = assets.SecurityHeadersHandler(securityHeadersConfig(options), handler)
+
+	// Outermost, so it sees the real status code whichever inner handler (PrecompressedAssetHandler
+	// or HTML5ModeHandler) ends up being the one that actually serves the request.
+	handler = assets.AssetRequestCountHandler(subcontextMap, scripts, stylesheets, handler)
+
 	return handler, nil
 }
 
+// isIndexTarget reports whether name is one of subcontextMap's index targets (e.g.
+// "index.html", "java/index.html") -- the dynamically rendered fallbacks HTML5ModeHandler
+// serves for a missing asset, as opposed to an immutable, fingerprinted bundle.
+func isIndexTarget(subcontextMap map[string]string, name string) bool {
+	for _, index := range subcontextMap {
+		if name == index {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionResourceArray merges the plain-URL form of an extension list with its
+// {url, integrity, crossOrigin} struct form into the single list HTML5ModeHandler renders,
+// so operators can keep using the simple plainURLs field for extensions that don't need
+// integrity pinning and only reach for structured when they do.
+func extensionResourceArray(plainURLs []string, structured []v1.ExtensionResource) []assets.ExtensionResource {
+	resources := make([]assets.ExtensionResource, 0, len(plainURLs)+len(structured))
+	for _, url := range plainURLs {
+		resources = append(resources, assets.ExtensionResource{URL: url})
+	}
+	for _, resource := range structured {
+		resources = append(resources, assets.ExtensionResource{
+			URL:         resource.URL,
+			Integrity:   resource.Integrity,
+			CrossOrigin: resource.CrossOrigin,
+		})
+	}
+	return resources
+}
+
+// contentSecurityPolicyTemplate builds the Content-Security-Policy value HTML5ModeHandler and
+// GeneratedConfigHandler render per-response, from the operator's configured policy (or
+// assets.DefaultContentSecurityPolicy if unset) with its <extension-origins> and <api-origins>
+// placeholders filled in. The {{nonce}} placeholder is left for the handlers themselves to
+// substitute per-request.
+//
+// If ContentSecurityPolicyReportingEndpoint is set, a report-to directive naming the
+// "csp-endpoint" group is appended (plus the deprecated report-uri, for browsers that don't
+// yet support report-to) so violations are actually delivered to cspReportEndpoint; see
+// securityHeadersConfig for the matching Reporting-Endpoints/Report-To response headers.
+//
+// If any script or stylesheet pins a Subresource Integrity value, a require-sri-for
+// directive is appended so a browser rejects any script/style resource served without one --
+// including one an operator forgot to pin, not just the ones that are pinned.
+func contentSecurityPolicyTemplate(options v1.WebConsoleConfiguration, scripts, stylesheets []assets.ExtensionResource) string {
+	policy := options.Features.ContentSecurityPolicy
+	if len(policy) == 0 {
+		policy = assets.DefaultContentSecurityPolicy
+	}
+
+	extensionOrigins := assets.OriginsFromURLs(append(
+		resourceURLs(scripts),
+		resourceURLs(stylesheets)...,
+	))
+	apiOrigins := assets.OriginsFromURLs([]string{
+		options.ClusterInfo.MasterPublicURL,
+		options.ClusterInfo.LoggingPublicURL,
+		options.ClusterInfo.MetricsPublicURL,
+	})
+
+	template := assets.BuildContentSecurityPolicyTemplate(policy, extensionOrigins, apiOrigins)
+	if endpoint := options.Features.ContentSecurityPolicyReportingEndpoint; len(endpoint) > 0 {
+		template += fmt.Sprintf("; report-uri %s; report-to csp-endpoint", endpoint)
+	}
+	if anyResourceHasIntegrity(scripts) || anyResourceHasIntegrity(stylesheets) {
+		template += "; require-sri-for script style"
+	}
+	return template
+}
+
+// anyResourceHasIntegrity reports whether any resource in resources pins a Subresource
+// Integrity value.
+func anyResourceHasIntegrity(resources []assets.ExtensionResource) bool {
+	for _, resource := range resources {
+		if len(resource.Integrity) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// securityHeadersConfig builds the assets.SecurityHeadersConfig SecurityHeadersHandler renders
+// on every response from the operator's Features configuration. Each field defaults to unset,
+// so an operator who hasn't opted in doesn't suddenly get an HSTS or COOP/COEP header that
+// breaks an extension or a TLS setup this server doesn't fully control.
+func securityHeadersConfig(options v1.WebConsoleConfiguration) assets.SecurityHeadersConfig {
+	return assets.SecurityHeadersConfig{
+		StrictTransportSecurity:   options.Features.StrictTransportSecurity,
+		CrossOriginOpenerPolicy:   options.Features.CrossOriginOpenerPolicy,
+		CrossOriginEmbedderPolicy: options.Features.CrossOriginEmbedderPolicy,
+		ReportingEndpoint:         options.Features.ContentSecurityPolicyReportingEndpoint,
+	}
+}
+
+func resourceURLs(resources []assets.ExtensionResource) []string {
+	urls := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		urls = append(urls, resource.URL)
+	}
+	return urls
+}
+
 // Have to convert to arrays because go templates are limited and we need to be able to know
 // if we are on the last index for trailing commas in JSON
 func extensionPropertyArray(extensionProperties map[string]string) []assets.WebConsoleExtensionProperty {
@@ -15,6 +15,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericapiserveroptions "k8s.io/apiserver/pkg/server/options"
@@ -27,6 +28,8 @@ import (
 	"github.com/openshift/origin-web-console-server/pkg/apis/webconsole/validation"
 	webconsoleserver "github.com/openshift/origin-web-console-server/pkg/assets/apiserver"
 	"github.com/openshift/origin-web-console-server/pkg/origin-common/crypto"
+	"github.com/openshift/origin-web-console-server/pkg/tls/acme"
+	"github.com/openshift/origin-web-console-server/pkg/tls/reload"
 	builtversion "github.com/openshift/origin-web-console-server/pkg/version"
 )
 
@@ -39,6 +42,9 @@ type WebConsoleServerOptions struct {
 	StdErr io.Writer
 
 	WebConsoleConfig *v1.WebConsoleConfiguration
+	// configFile is the path WebConsoleConfig was loaded from, if any. It's kept around so
+	// RunWebConsoleServer can watch it for hot-reload.
+	configFile string
 }
 
 func NewWebConsoleServerOptions(out, errOut io.Writer) *WebConsoleServerOptions {
@@ -97,49 +103,80 @@ func (o WebConsoleServerOptions) Validate(args []string) error {
 		return apierrors.NewInvalid(schema.GroupKind{Group: "webconsole.config.openshift.io", Kind: "AssetConfig"}, "", validationResults.Errors)
 	}
 
+	if errs := o.validateAudit(); len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
 	return nil
 }
 
+// validateAudit surfaces a misconfigured audit policy file (or other --audit-* flag
+// mistakes) as a start-up error instead of failing later the first time a request needs
+// to be audited.
+func (o WebConsoleServerOptions) validateAudit() []error {
+	if o.Audit == nil {
+		return nil
+	}
+	return o.Audit.Validate()
+}
+
 func (o *WebConsoleServerOptions) Complete(cmd *cobra.Command) error {
 	configFile, err := cmd.Flags().GetString("config")
 	if err != nil {
 		return err
 	}
 	if len(configFile) > 0 {
-		content, err := ioutil.ReadFile(configFile)
-		if err != nil {
-			return err
-		}
-		configObj, err := runtime.Decode(configCodecs.UniversalDecoder(v1.SchemeGroupVersion, schema.GroupVersion{Group: "", Version: "v1"}), content)
+		config, err := decodeWebConsoleConfig(configFile)
 		if err != nil {
 			return err
 		}
-		config, ok := configObj.(*v1.WebConsoleConfiguration)
-		if !ok {
-			return fmt.Errorf("unexpected type: %T", configObj)
-		}
-
-		// TODO we have no codegeneration at the moment, so manually apply defaults
-		localwebconsolev1.SetDefaults_WebConsoleConfiguration(config)
-		webconsoleapiutil.ResolveWebConsoleConfigurationPaths(config, path.Dir(configFile))
 
 		o.WebConsoleConfig = config
+		o.configFile = configFile
 	}
 
 	return nil
 }
 
-func (o WebConsoleServerOptions) Config() (*webconsoleserver.AssetServerConfig, error) {
+// decodeWebConsoleConfig reads and defaults a WebConsoleConfiguration from configFile. It
+// is also used by the config-reload watch to re-read the file on every change.
+func decodeWebConsoleConfig(configFile string) (*v1.WebConsoleConfiguration, error) {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	configObj, err := runtime.Decode(configCodecs.UniversalDecoder(v1.SchemeGroupVersion, schema.GroupVersion{Group: "", Version: "v1"}), content)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := configObj.(*v1.WebConsoleConfiguration)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type: %T", configObj)
+	}
+
+	// TODO we have no codegeneration at the moment, so manually apply defaults
+	localwebconsolev1.SetDefaults_WebConsoleConfiguration(config)
+	webconsoleapiutil.ResolveWebConsoleConfigurationPaths(config, path.Dir(configFile))
+
+	return config, nil
+}
+
+// Config builds the AssetServerConfig to start the server with. It also returns a
+// *reload.CertificateStore when the serving certificate was loaded from a static
+// certFile/keyFile, so RunWebConsoleServer can have ConfigReloader keep it current; it
+// returns nil when ACME is configured instead, since autocert.Manager already renews and
+// swaps in its own certificates without help.
+func (o WebConsoleServerOptions) Config() (*webconsoleserver.AssetServerConfig, *reload.CertificateStore, error) {
 	// all this work is ordinarily done by using the default flags to configure the listener options
 	// instead of doing that, we're keeping the config inside of a single config file, so we're doing this
 	// transformation here.
 	bindHost, portString, err := net.SplitHostPort(o.WebConsoleConfig.ServingInfo.BindAddress)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	port, err := strconv.Atoi(portString)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	sniCertKeys := []utilflag.NamedCertKey{}
 	for _, nc := range o.WebConsoleConfig.ServingInfo.NamedCertificates {
@@ -166,20 +203,20 @@ func (o WebConsoleServerOptions) Config() (*webconsoleserver.AssetServerConfig,
 
 	serverConfig, err := webconsoleserver.NewAssetServerConfig(*o.WebConsoleConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if err := secureServingOptions.ApplyTo(&serverConfig.GenericConfig.Config); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := genericapiserveroptions.NewCoreAPIOptions().ApplyTo(serverConfig.GenericConfig); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := o.Audit.ApplyTo(&serverConfig.GenericConfig.Config); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := o.Features.ApplyTo(&serverConfig.GenericConfig.Config); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// all this work is ordinarily done by using the default flags to configure the listener options
@@ -188,11 +225,36 @@ func (o WebConsoleServerOptions) Config() (*webconsoleserver.AssetServerConfig,
 	serverConfig.GenericConfig.SecureServingInfo.MinTLSVersion = crypto.TLSVersionOrDie(o.WebConsoleConfig.ServingInfo.MinTLSVersion)
 	serverConfig.GenericConfig.SecureServingInfo.CipherSuites = crypto.CipherSuitesOrDie(o.WebConsoleConfig.ServingInfo.CipherSuites)
 
-	return serverConfig, nil
+	var certStore *reload.CertificateStore
+	// An empty certFile with ACME configured means the operator wants us to obtain and renew
+	// the serving certificate ourselves rather than loading it from disk.
+	if len(o.WebConsoleConfig.ServingInfo.CertFile) == 0 && o.WebConsoleConfig.ServingInfo.ACME != nil {
+		tlsConfig, err := acme.NewTLSConfig(*o.WebConsoleConfig.ServingInfo.ACME, o.WebConsoleConfig.ServingInfo.NamedCertificates)
+		if err != nil {
+			return nil, nil, err
+		}
+		serverConfig.GenericConfig.SecureServingInfo.GetCertificate = tlsConfig.GetCertificate
+		// autocert.Manager.TLSConfig() also advertises the "acme-tls/1" ALPN protocol via
+		// NextProtos; without it the TLS-ALPN-01 challenge autocert answers inside
+		// GetCertificate above never gets negotiated, and issuance can't complete.
+		serverConfig.GenericConfig.SecureServingInfo.NextProtos = tlsConfig.NextProtos
+	} else {
+		// Route the static cert/key (and any SNI NamedCertificates) through a
+		// CertificateStore instead of letting ApplyTo's one-time load stand, so
+		// ConfigReloader can rotate them in place the same way it already reloads
+		// WebConsoleConfiguration, without requiring a pod restart.
+		certStore, err = reload.NewCertificateStore(o.WebConsoleConfig.ServingInfo.CertFile, o.WebConsoleConfig.ServingInfo.KeyFile, o.WebConsoleConfig.ServingInfo.NamedCertificates)
+		if err != nil {
+			return nil, nil, err
+		}
+		serverConfig.GenericConfig.SecureServingInfo.GetCertificate = certStore.GetCertificate
+	}
+
+	return serverConfig, certStore, nil
 }
 
 func (o WebConsoleServerOptions) RunWebConsoleServer(stopCh <-chan struct{}) error {
-	config, err := o.Config()
+	config, certStore, err := o.Config()
 	if err != nil {
 		return err
 	}
@@ -205,6 +267,29 @@ func (o WebConsoleServerOptions) RunWebConsoleServer(stopCh <-chan struct{}) err
 	if err != nil {
 		return err
 	}
+
+	if len(o.configFile) > 0 {
+		onReload := func(config *v1.WebConsoleConfiguration) error {
+			if err := server.ReloadWebConsoleConfig(*config); err != nil {
+				return err
+			}
+			// Rotating a static cert/key no longer needs a pod restart: reload it
+			// from disk on the same trigger as WebConsoleConfiguration itself,
+			// right alongside it, and swap it into certStore atomically.
+			if certStore != nil {
+				return certStore.Reload(config.ServingInfo.CertFile, config.ServingInfo.KeyFile, config.ServingInfo.NamedCertificates)
+			}
+			return nil
+		}
+		reloader, err := webconsoleserver.NewConfigReloader(o.configFile, decodeWebConsoleConfig, onReload)
+		if err != nil {
+			return err
+		}
+		if err := reloader.Run(stopCh); err != nil {
+			return err
+		}
+	}
+
 	glog.Infof("OpenShift Web Console Version: %s", builtversion.Get().String())
 	return server.GenericAPIServer.PrepareRun().Run(stopCh)
 }
@@ -0,0 +1,134 @@
+package apiserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/api/webconsole/v1"
+)
+
+// oidcDiscoveryMetadata is the subset of the OpenID Connect Discovery 1.0 response
+// ("OpenID Provider Metadata") this server cares about.
+// See: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type oidcDiscoveryMetadata struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oauthEndpointSource resolves OAuthAuthorizationEndpoint/OAuthTokenEndpoint (and, for an
+// external OIDC issuer, JWKSURI/EndSessionEndpoint and the effective client ID) during
+// Complete(). The default source asks the kube master's well-known URL; discoverOIDCIssuerMetadata
+// is used instead when OAuthConfig.IssuerURL is configured.
+func resolveOAuthEndpoints(restClient *kubernetes.Clientset, config v1.WebConsoleConfiguration) (OAuthAuthorizationServerMetadata, string, string, error) {
+	oauthConfig := config.OAuthConfig
+	clientID := oauthConfig.ClientID
+	if len(clientID) == 0 {
+		clientID = OpenShiftWebConsoleClientID
+	}
+
+	if len(oauthConfig.IssuerURL) == 0 {
+		metadata, err := discoverMasterOAuthMetadata(restClient)
+		return metadata, clientID, "master", err
+	}
+
+	discovered, err := discoverOIDCIssuerMetadata(oauthConfig.IssuerURL, oauthConfig.DiscoveryCAFile)
+	if err != nil {
+		return OAuthAuthorizationServerMetadata{}, clientID, "oidc-issuer", err
+	}
+
+	metadata := OAuthAuthorizationServerMetadata{
+		AuthorizationEndpoint: discovered.AuthorizationEndpoint,
+		TokenEndpoint:         discovered.TokenEndpoint,
+		JWKSURI:               discovered.JWKSURI,
+		EndSessionEndpoint:    discovered.EndSessionEndpoint,
+	}
+
+	// Explicit overrides in the config file always win over discovery.
+	if len(oauthConfig.AuthorizationEndpoint) > 0 {
+		metadata.AuthorizationEndpoint = oauthConfig.AuthorizationEndpoint
+	}
+	if len(oauthConfig.TokenEndpoint) > 0 {
+		metadata.TokenEndpoint = oauthConfig.TokenEndpoint
+	}
+
+	if len(metadata.AuthorizationEndpoint) == 0 || len(metadata.TokenEndpoint) == 0 {
+		return metadata, clientID, "oidc-issuer", fmt.Errorf("authorization or token endpoint missing from OIDC provider metadata for issuer %q (authorization endpoint: %q, token endpoint: %q)", oauthConfig.IssuerURL, metadata.AuthorizationEndpoint, metadata.TokenEndpoint)
+	}
+
+	return metadata, clientID, "oidc-issuer", nil
+}
+
+// discoverMasterOAuthMetadata is the original discovery path: ask the kube master's
+// well-known OAuth 2.0 Authorization Server Metadata endpoint.
+func discoverMasterOAuthMetadata(restClient *kubernetes.Clientset) (OAuthAuthorizationServerMetadata, error) {
+	resultBytes, err := restClient.RESTClient().Get().AbsPath(oauthMetadataEndpoint).Do().Raw()
+	if err != nil {
+		return OAuthAuthorizationServerMetadata{}, err
+	}
+	metadata := OAuthAuthorizationServerMetadata{}
+	if err := json.Unmarshal(resultBytes, &metadata); err != nil {
+		return OAuthAuthorizationServerMetadata{}, err
+	}
+	if len(metadata.AuthorizationEndpoint) == 0 || len(metadata.TokenEndpoint) == 0 {
+		return metadata, fmt.Errorf("authorization or token endpoint missing from OAuth authorization server metadata (authorization endpoint: %q, token endpoint: %q)", metadata.AuthorizationEndpoint, metadata.TokenEndpoint)
+	}
+	return metadata, nil
+}
+
+// discoverOIDCIssuerMetadata fetches "${issuerURL}/.well-known/openid-configuration" using
+// an HTTP client trusting discoveryCAFile (the system roots if empty).
+func discoverOIDCIssuerMetadata(issuerURL, discoveryCAFile string) (oidcDiscoveryMetadata, error) {
+	client, err := httpClientForCABundle(discoveryCAFile)
+	if err != nil {
+		return oidcDiscoveryMetadata{}, err
+	}
+
+	resp, err := client.Get(issuerURL + "/.well-known/openid-configuration")
+	if err != nil {
+		return oidcDiscoveryMetadata{}, fmt.Errorf("error discovering OIDC provider metadata for issuer %q: %v", issuerURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return oidcDiscoveryMetadata{}, fmt.Errorf("error discovering OIDC provider metadata for issuer %q: unexpected status %s", issuerURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return oidcDiscoveryMetadata{}, err
+	}
+
+	metadata := oidcDiscoveryMetadata{}
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return oidcDiscoveryMetadata{}, fmt.Errorf("error parsing OIDC provider metadata for issuer %q: %v", issuerURL, err)
+	}
+	return metadata, nil
+}
+
+func httpClientForCABundle(caFile string) (*http.Client, error) {
+	if len(caFile) == 0 {
+		return http.DefaultClient, nil
+	}
+
+	caBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading discoveryCAFile %q: %v", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("no valid certificates found in discoveryCAFile %q", caFile)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
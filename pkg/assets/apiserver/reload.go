@@ -0,0 +1,166 @@
+package apiserver
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/openshift/api/webconsole/v1"
+	"github.com/openshift/origin-web-console-server/pkg/apis/webconsole/validation"
+)
+
+// DecodeConfigFunc reads and defaults a WebConsoleConfiguration from disk, the same way
+// WebConsoleServerOptions.Complete does for the initial load.
+type DecodeConfigFunc func(configFile string) (*v1.WebConsoleConfiguration, error)
+
+// ConfigReloadFunc is invoked with a freshly decoded and validated configuration whenever the
+// watched config file changes on disk. Implementations should swap their live state
+// atomically and return an error if the new configuration could not be applied, in which
+// case the previous configuration stays live.
+type ConfigReloadFunc func(config *v1.WebConsoleConfiguration) error
+
+// ConfigReloader watches a WebConsoleConfiguration file for changes and re-applies the
+// configuration without requiring the process to restart. A reload is also triggered on
+// SIGHUP, matching the convention most long-running OpenShift components use.
+//
+// It deliberately does not watch ServingInfo's cert/key files directly: they change on their
+// own schedule (e.g. cert-manager renewing ahead of expiry), independent of
+// WebConsoleConfiguration edits. Instead, ConfigReloadFunc re-reads and swaps them in itself
+// on every trigger -- see WebConsoleServerOptions.RunWebConsoleServer's onReload, which also
+// reloads the cert/key via a reload.CertificateStore when one was wired in by Config(). ACME
+// certs need no help either way, since autocert.Manager already renews and swaps in its own.
+type ConfigReloader struct {
+	configFile string
+	decode     DecodeConfigFunc
+	onReload   ConfigReloadFunc
+
+	watcher *fsnotify.Watcher
+}
+
+// NewConfigReloader creates a ConfigReloader for configFile. decode is used to re-read
+// configFile on every reload.
+func NewConfigReloader(configFile string, decode DecodeConfigFunc, onReload ConfigReloadFunc) (*ConfigReloader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigReloader{
+		configFile: configFile,
+		decode:     decode,
+		onReload:   onReload,
+		watcher:    watcher,
+	}, nil
+}
+
+// Run watches the config file until stopCh is closed. It returns once it has tried to
+// establish the initial watch (a failure to watch is logged, not returned, and SIGHUP still
+// triggers reloads); reloads happen on a background goroutine.
+func (r *ConfigReloader) Run(stopCh <-chan struct{}) error {
+	if err := r.addWatches(); err != nil {
+		return err
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sighup)
+		defer r.watcher.Close()
+
+		for {
+			select {
+			case event, ok := <-r.watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+					continue
+				}
+				// A ConfigMap update never touches configFile's own symlink, only the
+				// ..data symlink it resolves through, so a change to ..data counts as a
+				// change to configFile. Any other entry in the watched directory is
+				// irrelevant to us.
+				if filepath.Clean(event.Name) != filepath.Clean(r.configFile) && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+				glog.V(2).Infof("config-reload: detected change to %s, reloading", event.Name)
+				r.reload()
+			case err, ok := <-r.watcher.Errors:
+				if !ok {
+					return
+				}
+				glog.Errorf("config-reload: watch error: %v", err)
+			case <-sighup:
+				glog.Infof("config-reload: received SIGHUP, reloading %s", r.configFile)
+				r.reload()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload re-reads and validates the config file, and applies it via onReload if it is valid,
+// keeping the previous configuration live otherwise.
+func (r *ConfigReloader) reload() {
+	config, err := r.decode(r.configFile)
+	if err != nil {
+		glog.Errorf("config-reload: failed to read %s, keeping previous configuration: %v", r.configFile, err)
+		return
+	}
+
+	if results := validation.ValidateWebConsoleConfiguration(config, field.NewPath("config")); len(results.Errors) > 0 {
+		glog.Errorf("config-reload: rejected invalid configuration from %s, keeping previous configuration: %v", r.configFile, results.Errors.ToAggregate())
+		return
+	}
+
+	if err := r.onReload(config); err != nil {
+		glog.Errorf("config-reload: failed to apply new configuration, keeping previous configuration: %v", err)
+		return
+	}
+}
+
+// addWatches establishes a watch on the config file's parent directory rather than the file
+// itself: Kubernetes mounts a ConfigMap as a symlink into its containing directory and updates
+// it with an atomic symlink swap, which deletes the inode a direct file watch is tracking.
+// Watching the directory survives that swap, so every subsequent ConfigMap update keeps
+// triggering a reload instead of just the first one. It is safe to call repeatedly; fsnotify
+// ignores duplicate adds.
+func (r *ConfigReloader) addWatches() error {
+	dir := filepath.Dir(r.configFile)
+	if err := r.watcher.Add(dir); err != nil {
+		glog.Warningf("config-reload: could not watch %s: %v", dir, err)
+	}
+	return nil
+}
+
+// reloadableHandler is an http.Handler whose delegate can be swapped atomically, so a
+// reload can install a newly generated handler without racing in-flight requests.
+type reloadableHandler struct {
+	current atomic.Value
+}
+
+func newReloadableHandler(initial http.Handler) *reloadableHandler {
+	h := &reloadableHandler{}
+	h.Set(initial)
+	return h
+}
+
+func (h *reloadableHandler) Set(handler http.Handler) {
+	h.current.Store(handler)
+}
+
+func (h *reloadableHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.current.Load().(http.Handler).ServeHTTP(w, req)
+}
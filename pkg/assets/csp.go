@@ -0,0 +1,96 @@
+package assets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultContentSecurityPolicy is used when the operator hasn't configured one explicitly.
+// <extension-origins> and <api-origins> are filled in once, at startup, from the configured
+// extensions and API endpoints; {{nonce}} is filled in fresh for every HTML response.
+const DefaultContentSecurityPolicy = `default-src 'self'; script-src 'self' 'nonce-{{nonce}}' <extension-origins>; style-src 'self' 'nonce-{{nonce}}' <extension-origins>; connect-src 'self' <api-origins>; frame-ancestors 'none'`
+
+// cspNoncePlaceholder is baked into every inline <script>/<style> tag once, at handler
+// construction time, and swapped for a fresh nonce on every request. It's unlikely enough to
+// collide with real content that we don't bother making it unpredictable itself.
+const cspNoncePlaceholder = "__CSP_NONCE_PLACEHOLDER__"
+
+var scriptOrStyleTagOpenRegexp = regexp.MustCompile(`<(script|style)\b`)
+
+// injectNonceAttrs adds a nonce attribute carrying cspNoncePlaceholder to every <script> and
+// <style> tag in content, so renderNonce can later swap in a fresh value per request.
+func injectNonceAttrs(content []byte) []byte {
+	return scriptOrStyleTagOpenRegexp.ReplaceAll(content, []byte(`<$1 nonce="`+cspNoncePlaceholder+`"`))
+}
+
+// renderNonce swaps every cspNoncePlaceholder baked into content by injectNonceAttrs for
+// nonce.
+func renderNonce(content []byte, nonce string) []byte {
+	return []byte(strings.Replace(string(content), cspNoncePlaceholder, nonce, -1))
+}
+
+// GenerateNonce returns a fresh cryptographically random value suitable for use as a
+// Content-Security-Policy nonce-source and the matching script/style nonce attribute.
+func GenerateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating Content-Security-Policy nonce: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// renderContentSecurityPolicy substitutes the {{nonce}} placeholder left by
+// BuildContentSecurityPolicyTemplate with nonce.
+func renderContentSecurityPolicy(template, nonce string) string {
+	return strings.Replace(template, "{{nonce}}", nonce, -1)
+}
+
+// BuildContentSecurityPolicyTemplate substitutes the static <extension-origins> and
+// <api-origins> placeholders in policy with the actual origins the console needs to load
+// scripts/styles/API calls from, leaving the {{nonce}} placeholder for renderContentSecurityPolicy
+// to fill in on every request.
+func BuildContentSecurityPolicyTemplate(policy string, extensionOrigins []string, apiOrigins []string) string {
+	// -1 (replace all), not 1: DefaultContentSecurityPolicy has an <extension-origins>
+	// placeholder in both script-src and style-src, and a custom policy may repeat it too.
+	policy = strings.Replace(policy, "<extension-origins>", strings.Join(extensionOrigins, " "), -1)
+	policy = strings.Replace(policy, "<api-origins>", strings.Join(apiOrigins, " "), -1)
+	return policy
+}
+
+// extensionOrigins returns the deduplicated scheme://host origins of resources, in the order
+// they first appear, for use in a Content-Security-Policy origin allowlist.
+func extensionOrigins(resources []ExtensionResource) []string {
+	urls := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		urls = append(urls, resource.URL)
+	}
+	return OriginsFromURLs(urls)
+}
+
+// OriginsFromURLs returns the deduplicated scheme://host origins parsed out of urls, in the
+// order they first appear, skipping anything that doesn't parse into an absolute URL. It's
+// used to build the extension-origins and api-origins allowlists of a Content-Security-Policy.
+func OriginsFromURLs(urls []string) []string {
+	seen := map[string]bool{}
+	origins := []string{}
+	for _, rawURL := range urls {
+		if len(rawURL) == 0 {
+			continue
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil || len(parsed.Scheme) == 0 || len(parsed.Host) == 0 {
+			continue
+		}
+		origin := parsed.Scheme + "://" + parsed.Host
+		if seen[origin] {
+			continue
+		}
+		seen[origin] = true
+		origins = append(origins, origin)
+	}
+	return origins
+}
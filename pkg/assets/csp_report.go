@@ -0,0 +1,200 @@
+package assets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/origin-web-console-server/pkg/assets/metrics"
+)
+
+// maxCSPReportBytes bounds the size of a single CSP violation report body. Browsers' own
+// reports are tiny (a handful of URLs and directive strings); anything bigger is either
+// malformed or abusive, and there's no reason to read it all into memory to find out which.
+const maxCSPReportBytes = 64 * 1024
+
+// CSPReport is the normalized form of a Content-Security-Policy violation report,
+// regardless of which of the two wire formats CSPReportHandler parsed it from.
+type CSPReport struct {
+	DocumentURI        string
+	Referrer           string
+	ViolatedDirective  string
+	EffectiveDirective string
+	OriginalPolicy     string
+	BlockedURI         string
+	Disposition        string
+	StatusCode         int
+}
+
+// ReportSink receives every CSPReport CSPReportHandler accepts. Implementations must not
+// block: CSPReportHandler calls Report synchronously, on the request goroutine, before
+// responding to the browser.
+type ReportSink interface {
+	Report(report CSPReport)
+}
+
+// MultiReportSink fans a report out to every sink in it, so CSPReportHandler can be handed
+// several sinks (e.g. logs and metrics) as if they were one.
+type MultiReportSink []ReportSink
+
+func (sinks MultiReportSink) Report(report CSPReport) {
+	for _, sink := range sinks {
+		sink.Report(report)
+	}
+}
+
+// LogReportSink logs every CSP violation report, so an operator who hasn't wired up
+// anything fancier still has visibility into extension breakage or XSS attempts.
+type LogReportSink struct{}
+
+func (LogReportSink) Report(report CSPReport) {
+	glog.Warningf("Content-Security-Policy violation: directive=%q blocked-uri=%q document-uri=%q disposition=%q",
+		report.ViolatedDirective, report.BlockedURI, report.DocumentURI, report.Disposition)
+}
+
+// MetricsReportSink increments metrics.CSPViolationCount for every CSP violation report,
+// labeled by the violated directive, the blocked URI's host, and the disposition. A blocked
+// URI with a host is reduced to that host (its path and query are dropped); one without a
+// host, such as the "inline" or "eval" keywords, is used unchanged as the label value, so
+// the label's values are not bounded for reports of that kind.
+type MetricsReportSink struct{}
+
+func (MetricsReportSink) Report(report CSPReport) {
+	metrics.CSPViolationCount.WithLabelValues(report.ViolatedDirective, blockedURIHost(report.BlockedURI), report.Disposition).Inc()
+}
+
+func blockedURIHost(blockedURI string) string {
+	parsed, err := url.Parse(blockedURI)
+	if err != nil || len(parsed.Host) == 0 {
+		return blockedURI
+	}
+	return parsed.Host
+}
+
+// legacyCSPReportEnvelope is the body shape a browser POSTs as application/csp-report, the
+// reporting mechanism CSP level 2 defined before the general-purpose Reporting API replaced
+// it. See https://www.w3.org/TR/CSP3/#deprecated-serialize-violation.
+type legacyCSPReportEnvelope struct {
+	Report legacyCSPReportBody `json:"csp-report"`
+}
+
+type legacyCSPReportBody struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	BlockedURI         string `json:"blocked-uri"`
+	Disposition        string `json:"disposition"`
+	StatusCode         int    `json:"status-code"`
+}
+
+// reportingAPIReport is one element of the application/reports+json body the Reporting API
+// POSTs, which can batch reports of several types together; only "csp-violation" ones are
+// CSP reports.
+type reportingAPIReport struct {
+	Type string                    `json:"type"`
+	Body reportingAPICSPReportBody `json:"body"`
+}
+
+type reportingAPICSPReportBody struct {
+	DocumentURL        string `json:"documentURL"`
+	Referrer           string `json:"referrer"`
+	ViolatedDirective  string `json:"violatedDirective"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	OriginalPolicy     string `json:"originalPolicy"`
+	BlockedURL         string `json:"blockedURL"`
+	Disposition        string `json:"disposition"`
+	StatusCode         int    `json:"statusCode"`
+}
+
+// parseCSPReports decodes body according to contentType, returning every CSP violation report
+// it contains. application/reports+json can batch multiple reports (and report types other
+// than CSP violations, which are skipped); the legacy application/csp-report shape, and
+// anything else, is parsed as a single report.
+func parseCSPReports(contentType string, body []byte) ([]CSPReport, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+
+	if mediaType == "application/reports+json" {
+		var raw []reportingAPIReport
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, err
+		}
+		reports := make([]CSPReport, 0, len(raw))
+		for _, entry := range raw {
+			if entry.Type != "csp-violation" {
+				continue
+			}
+			reports = append(reports, CSPReport{
+				DocumentURI:        entry.Body.DocumentURL,
+				Referrer:           entry.Body.Referrer,
+				ViolatedDirective:  entry.Body.ViolatedDirective,
+				EffectiveDirective: entry.Body.EffectiveDirective,
+				OriginalPolicy:     entry.Body.OriginalPolicy,
+				BlockedURI:         entry.Body.BlockedURL,
+				Disposition:        entry.Body.Disposition,
+				StatusCode:         entry.Body.StatusCode,
+			})
+		}
+		return reports, nil
+	}
+
+	var envelope legacyCSPReportEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	return []CSPReport{{
+		DocumentURI:        envelope.Report.DocumentURI,
+		Referrer:           envelope.Report.Referrer,
+		ViolatedDirective:  envelope.Report.ViolatedDirective,
+		EffectiveDirective: envelope.Report.EffectiveDirective,
+		OriginalPolicy:     envelope.Report.OriginalPolicy,
+		BlockedURI:         envelope.Report.BlockedURI,
+		Disposition:        envelope.Report.Disposition,
+		StatusCode:         envelope.Report.StatusCode,
+	}}, nil
+}
+
+// CSPReportHandler accepts POSTed Content-Security-Policy violation reports in either the
+// legacy application/csp-report format or the modern application/reports+json format (see
+// BuildContentSecurityPolicyTemplate and SecurityHeadersConfig.ReportingEndpoint for how a
+// browser is told to send them here) and forwards each one, normalized, to sink.
+//
+// A body larger than maxCSPReportBytes is refused with 413 Request Entity Too Large and
+// nothing is forwarded. A report that can't be parsed is discarded and still answered with
+// 204 No Content, like an accepted one; these come from untrusted clients and holding up the
+// response serves no one.
+func CSPReportHandler(sink ReportSink) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportBytes))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		reports, err := parseCSPReports(r.Header.Get("Content-Type"), body)
+		if err != nil {
+			glog.V(4).Infof("discarding unparsable Content-Security-Policy report: %v", err)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		for _, report := range reports {
+			sink.Report(report)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -3,63 +3,470 @@ package assets
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/audit"
+
+	"github.com/openshift/origin-web-console-server/pkg/assets/metrics"
 )
 
 var varyHeaderRegexp = regexp.MustCompile("\\s*,\\s*")
 
-type gzipResponseWriter struct {
-	io.Writer
+// compressionEncodings lists the content-codings GzipHandler knows how to produce, in
+// preference order (most preferred first). The name doubles as the value written to the
+// Content-Encoding/normalized Accept-Encoding headers. zstd is tried before br because it
+// compresses and, more importantly, decompresses console asset bundles faster at a
+// comparable ratio; a client that rejects it (or doesn't advertise it) falls back to br,
+// then gzip.
+var compressionEncodings = []string{"zstd", "br", "gzip"}
+
+// compressibleContentTypePrefixes lists the Content-Type prefixes GzipHandler will compress.
+// Everything else (chiefly images, fonts, and video, which arrive already compressed) is
+// served as-is, since recompressing already-compressed bytes burns CPU for no size benefit.
+var compressibleContentTypePrefixes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"image/svg+xml",
+}
+
+// minCompressibleResponseSize is the smallest response body GzipHandler bothers compressing.
+// Below it, a coding's framing overhead (gzip's ~18-byte header/trailer, br/zstd's own) can
+// exceed whatever bytes it saves, so it's not worth the CPU either way.
+const minCompressibleResponseSize = 256
+
+// isCompressibleContentType reports whether contentType (as it would appear in a Content-Type
+// response header, with or without a trailing "; charset=..." parameter) is worth compressing.
+func isCompressibleContentType(contentType string) bool {
+	if idx := strings.IndexByte(contentType, ';'); idx >= 0 {
+		contentType = contentType[:idx]
+	}
+	contentType = strings.TrimSpace(contentType)
+	for _, prefix := range compressibleContentTypePrefixes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionResponseWriter buffers a response's first bytes so GzipHandler can defer its
+// compress-or-not decision until it knows enough to apply isCompressibleContentType and
+// minCompressibleResponseSize: the Content-Type a handler set (or, failing that, what
+// http.DetectContentType sniffs from the buffered bytes) and whether the body is even large
+// enough for a coding's framing overhead to pay for itself. The decision is made once, the
+// first time either the buffer reaches minCompressibleResponseSize or the handler finishes
+// writing, and every byte before and after flows through the compressor (or straight to the
+// wrapped ResponseWriter) depending on which way it went.
+type compressionResponseWriter struct {
 	http.ResponseWriter
-	sniffDone bool
+	encoding string
+
+	buf           bytes.Buffer
+	statusCode    int
+	headerWritten bool
+
+	decided  bool
+	compress bool
+	cw       io.WriteCloser
+}
+
+func (w *compressionResponseWriter) WriteHeader(status int) {
+	if w.headerWritten {
+		return
+	}
+	w.statusCode = status
+	w.headerWritten = true
+}
+
+func (w *compressionResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() < minCompressibleResponseSize {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return w.write(b)
+}
+
+// decide picks whether to compress, based on the response's Content-Type and on whether the
+// buffer reached minCompressibleResponseSize, then flushes the
+// buffered bytes accumulated so far through whichever path was chosen.
+func (w *compressionResponseWriter) decide() error {
+	w.decided = true
+
+	contentType := w.Header().Get("Content-Type")
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(w.buf.Bytes())
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.compress = w.buf.Len() >= minCompressibleResponseSize && isCompressibleContentType(contentType)
+
+	metricLabel := "none"
+	if w.compress {
+		cw, err := newCompressingWriter(w.encoding, w.ResponseWriter)
+		if err != nil {
+			// Can't happen: w.encoding came from negotiateEncoding, which only returns
+			// values newCompressingWriter supports. Serve uncompressed rather than
+			// failing the request if it ever does.
+			w.compress = false
+		} else {
+			w.cw = cw
+			w.Header().Set("Content-Encoding", w.encoding)
+			metricLabel = w.encoding
+		}
+	}
+	metrics.CompressionCount.WithLabelValues(metricLabel).Inc()
+
+	if w.headerWritten {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+	}
+	_, err := w.write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressionResponseWriter) write(b []byte) (int, error) {
+	if w.compress {
+		return w.cw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Close decides (if the response never reached minCompressibleResponseSize to trigger that
+// decision on its own) and flushes and closes the underlying compressor, if compression was
+// chosen. It must be called once the wrapped handler returns.
+func (w *compressionResponseWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
+
+// newCompressingWriter returns an io.WriteCloser for encoding that writes its compressed
+// output to w. encoding must be one of compressionEncodings.
+func newCompressingWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case "br":
+		return brotli.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported content-encoding %q", encoding)
+	}
+}
+
+// parseAcceptEncodingQValues parses an Accept-Encoding header into a map of coding name (or
+// "*") to its q-value, defaulting to 1 for a coding with no explicit "q=" parameter. A
+// malformed q-value parameter is ignored, leaving that coding at the default of 1, since
+// RFC 7231 permits but doesn't require servers to reject a malformed request over it.
+func parseAcceptEncodingQValues(acceptEncoding string) map[string]float64 {
+	qValues := map[string]float64{}
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		coding = strings.TrimSpace(coding)
+		if len(coding) == 0 {
+			continue
+		}
+
+		name := coding
+		q := 1.0
+		if idx := strings.IndexByte(coding, ';'); idx >= 0 {
+			name = strings.TrimSpace(coding[:idx])
+			for _, param := range strings.Split(coding[idx+1:], ";") {
+				param = strings.TrimSpace(param)
+				if v, ok := stripPrefixFold(param, "q="); ok {
+					if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+						q = parsed
+					}
+				}
+			}
+		}
+		qValues[strings.ToLower(name)] = q
+	}
+	return qValues
+}
+
+// stripPrefixFold is strings.TrimPrefix with a case-insensitive prefix match and an ok
+// result, since HTTP parameter names ("q=" here) are case-insensitive.
+func stripPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return "", false
+	}
+	return s[len(prefix):], true
+}
+
+// negotiateEncoding picks the most preferred of compressionEncodings that acceptEncoding
+// explicitly advertises with a non-zero q-value (an explicit "q=0" means the client is
+// refusing that coding), or "" if none qualifies. A "*" advertised with a non-zero q-value
+// additionally makes any coding compressionEncodings doesn't already rule out available, as
+// a fallback of last resort, per RFC 7231 §5.3.4.
+func negotiateEncoding(acceptEncoding string) string {
+	return negotiateEncodingFrom(acceptEncoding, compressionEncodings)
 }
 
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
-	if !w.sniffDone {
-		if w.Header().Get("Content-Type") == "" {
-			w.Header().Set("Content-Type", http.DetectContentType(b))
+// negotiateEncodingFrom is negotiateEncoding generalized over an explicit candidate list, in
+// preference order, so PrecompressedAssetHandler can negotiate over precompressedEncodings
+// (a different set, in a different order) using the same q-value semantics.
+func negotiateEncodingFrom(acceptEncoding string, candidates []string) string {
+	qValues := parseAcceptEncodingQValues(acceptEncoding)
+
+	for _, encoding := range candidates {
+		if q, ok := qValues[encoding]; ok && q > 0 {
+			return encoding
+		}
+	}
+
+	if q, ok := qValues["*"]; ok && q > 0 {
+		for _, encoding := range candidates {
+			if _, explicit := qValues[encoding]; !explicit {
+				return encoding
+			}
 		}
-		w.sniffDone = true
 	}
-	return w.Writer.Write(b)
+	return ""
 }
 
-// GzipHandler wraps a http.Handler to support transparent gzip encoding.
+// GzipHandler wraps a http.Handler to support transparent gzip, Brotli, and Zstandard
+// response encoding, negotiated from the request's Accept-Encoding header per
+// compressionEncodings' preference order. Whether a given response actually gets compressed
+// is decided per-response by compressionResponseWriter, from its Content-Type
+// (isCompressibleContentType) and size (minCompressibleResponseSize), so a small or
+// already-compressed response isn't paid for twice.
 func GzipHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Accept-Encoding")
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			metrics.CompressionCount.WithLabelValues("none").Inc()
 			h.ServeHTTP(w, r)
 			return
 		}
 		// Normalize the Accept-Encoding header for improved caching
-		r.Header.Set("Accept-Encoding", "gzip")
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
-		h.ServeHTTP(&gzipResponseWriter{Writer: gz, ResponseWriter: w}, r)
+		r.Header.Set("Accept-Encoding", encoding)
+		cw := &compressionResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		h.ServeHTTP(cw, r)
 	})
 }
 
-func SecurityHeadersHandler(h http.Handler) http.Handler {
+// precompressedEncodings lists the content-codings BuildPrecompressedAssetCache computes
+// ahead of time. zstd is not among them: a client that advertises zstd but neither br nor gzip
+// falls back to the on-the-fly compression performed by GzipHandler, while one that also
+// advertises br or gzip is served the precompressed br or gzip bytes. Such zstd-only clients
+// are rare enough not to be worth the extra memory a third copy of every asset would carry.
+var precompressedEncodings = []string{"br", "gzip"}
+
+// PrecompressedAssetEntry holds one asset's precompressed bytes for every encoding in
+// precompressedEncodings, plus the Content-Type detected from its original, uncompressed
+// bytes and the hex-encoded sha256 of those bytes, used to give the asset a strong ETag.
+type PrecompressedAssetEntry struct {
+	ContentType string
+	ContentHash string
+	Encoded     map[string][]byte
+}
+
+// PrecompressedAssetCache maps an asset path (as requested, no leading slash) to its
+// precompressed bytes, built once at startup by BuildPrecompressedAssetCache.
+type PrecompressedAssetCache map[string]PrecompressedAssetEntry
+
+// JoinAssetNamesFuncs merges the asset names returned by multiple bindata packages' generated
+// AssetNames functions into the single list BuildPrecompressedAssetCache warms, mirroring
+// JoinAssetFuncs/JoinAssetDirFuncs.
+func JoinAssetNamesFuncs(fns ...func() []string) []string {
+	var names []string
+	for _, fn := range fns {
+		names = append(names, fn()...)
+	}
+	return names
+}
+
+// BuildPrecompressedAssetCache compresses every asset named by assetNames with each of
+// precompressedEncodings, so PrecompressedAssetHandler can serve the result directly instead
+// of paying compression cost on every request for immutable, bundled assets.
+func BuildPrecompressedAssetCache(getAsset AssetFunc, assetNames []string) (PrecompressedAssetCache, error) {
+	cache := PrecompressedAssetCache{}
+	for _, name := range assetNames {
+		content, err := getAsset(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading asset %q to precompress: %v", name, err)
+		}
+
+		encoded := map[string][]byte{}
+		for _, encoding := range precompressedEncodings {
+			var buf bytes.Buffer
+			cw, err := newCompressingWriter(encoding, &buf)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := cw.Write(content); err != nil {
+				return nil, fmt.Errorf("error precompressing asset %q with %s: %v", name, encoding, err)
+			}
+			if err := cw.Close(); err != nil {
+				return nil, fmt.Errorf("error precompressing asset %q with %s: %v", name, encoding, err)
+			}
+			encoded[encoding] = buf.Bytes()
+		}
+
+		sum := sha256.Sum256(content)
+		cache[name] = PrecompressedAssetEntry{
+			ContentType: http.DetectContentType(content),
+			ContentHash: hex.EncodeToString(sum[:]),
+			Encoded:     encoded,
+		}
+	}
+	return cache, nil
+}
+
+// PrecompressedAssetHandler serves an asset's precompressed bytes from cache (built once at
+// startup by BuildPrecompressedAssetCache) when the client's Accept-Encoding allows it, rather
+// than compressing the asset on the fly.
+//
+// This sits in front of HTML5ModeHandler, so a cache hit here (which covers the common case:
+// essentially every browser sends "Accept-Encoding: gzip" at least) never reaches
+// HTML5ModeHandler's own strong-ETag/immutable/Range handling for bundled assets. It therefore
+// duplicates that treatment here instead: a strong, content-hash-derived ETag, a year-long
+// "immutable" Cache-Control, and Range/If-Range support for resumable fetches of large fonts
+// and bundles, via the same http.ServeContent net/http itself uses to serve files.
+//
+// It should in turn be wrapped by SecurityHeadersHandler, not the other way around: a cache
+// hit here writes the response and returns without calling h, so headers installed only
+// inside h would never reach a served-from-cache request.
+//
+// h should still apply on-the-fly compression (GzipHandler) for requests this handler can't
+// satisfy, such as the dynamically generated index.html fallback, or a client that doesn't
+// advertise any of precompressedEncodings.
+func PrecompressedAssetHandler(cache PrecompressedAssetCache, h http.Handler) http.Handler {
+	builtAt := time.Now()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := strings.TrimPrefix(r.URL.Path, "/")
+		acceptEncoding := r.Header.Get("Accept-Encoding")
+
+		entry, ok := cache[urlPath]
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		encoding := negotiateEncodingFrom(acceptEncoding, precompressedEncodings)
+		content, ok := entry.Encoded[encoding]
+		if encoding == "" || !ok {
+			// Either the client refused (q=0) or didn't advertise any coding this asset
+			// was precompressed with; fall through to on-the-fly negotiation, which knows
+			// about the full compressionEncodings set (including zstd).
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		// Normalize Accept-Encoding to the negotiated coding, as GzipHandler does before
+		// HTML5ModeHandler sees the request.
+		r.Header.Set("Accept-Encoding", encoding)
+		// The compressed bytes differ per encoding, so fold Accept-Encoding into the
+		// ETag the same way generateStrongEtag does for HTML5ModeHandler's identical
+		// assetCache hit, keeping the two paths' ETags for the same request equivalent.
+		etag := generateStrongEtag(r, entry.ContentHash, []string{"Accept-Encoding"})
+
+		if match := r.Header.Get("If-Match"); len(match) > 0 && match != "*" && match != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			metrics.ETagCacheHitCount.WithLabelValues("true").Inc()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		metrics.ETagCacheHitCount.WithLabelValues("false").Inc()
+
+		metrics.CompressionCount.WithLabelValues(encoding).Inc()
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Type", entry.ContentType)
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("ETag", etag)
+		// ServeContent honors Range/If-Range against the ETag and Last-Modified already
+		// set above, so a paused download of a large bundle or font can resume instead
+		// of restarting from byte zero.
+		http.ServeContent(w, r, urlPath, builtAt, bytes.NewReader(content))
+	})
+}
+
+// SecurityHeadersConfig holds the operator-configurable headers SecurityHeadersHandler adds
+// to every response, beyond the unconditional baseline it always sends. Each field is the
+// literal header value to send; an empty field leaves the corresponding header unset, since
+// some of these (notably HSTS) are only safe to send once TLS is known to be correctly
+// configured end-to-end.
+type SecurityHeadersConfig struct {
+	// StrictTransportSecurity is the value of the Strict-Transport-Security header, e.g.
+	// "max-age=31536000; includeSubDomains".
+	StrictTransportSecurity string
+	// CrossOriginOpenerPolicy is the value of the Cross-Origin-Opener-Policy header, e.g.
+	// "same-origin".
+	CrossOriginOpenerPolicy string
+	// CrossOriginEmbedderPolicy is the value of the Cross-Origin-Embedder-Policy header, e.g.
+	// "require-corp".
+	CrossOriginEmbedderPolicy string
+	// ReportingEndpoint, if set, is the absolute URL CSPReportHandler is mounted at. It's
+	// advertised to the browser via the Reporting-Endpoints and (legacy) Report-To headers,
+	// so a Content-Security-Policy using the matching "report-to csp-endpoint" directive
+	// knows where to deliver its violation reports.
+	ReportingEndpoint string
+}
+
+// SecurityHeadersHandler adds the baseline hardening headers to every response, plus whatever
+// of HSTS/COOP/COEP the operator has enabled in config. The console's Content-Security-Policy
+// is set separately, by HTML5ModeHandler and GeneratedConfigHandler, since it carries a
+// per-response nonce that only those handlers know how to generate and inject into index.html.
+func SecurityHeadersHandler(config SecurityHeadersConfig, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("X-DNS-Prefetch-Control", "off")
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		if len(config.StrictTransportSecurity) > 0 {
+			w.Header().Set("Strict-Transport-Security", config.StrictTransportSecurity)
+		}
+		if len(config.CrossOriginOpenerPolicy) > 0 {
+			w.Header().Set("Cross-Origin-Opener-Policy", config.CrossOriginOpenerPolicy)
+		}
+		if len(config.CrossOriginEmbedderPolicy) > 0 {
+			w.Header().Set("Cross-Origin-Embedder-Policy", config.CrossOriginEmbedderPolicy)
+		}
+		if len(config.ReportingEndpoint) > 0 {
+			w.Header().Set("Reporting-Endpoints", fmt.Sprintf(`csp-endpoint="%s"`, config.ReportingEndpoint))
+			// Report-To is deprecated in favor of Reporting-Endpoints, but Safari and
+			// older Chromium only honor it, so both are sent during the transition.
+			w.Header().Set("Report-To", fmt.Sprintf(`{"group":"csp-endpoint","max_age":10886400,"endpoints":[{"url":"%s"}]}`, config.ReportingEndpoint))
+		}
 		h.ServeHTTP(w, r)
 	})
 }
@@ -72,6 +479,18 @@ func generateEtag(r *http.Request, version string, varyHeaders []string) string
 	return fmt.Sprintf("W/\"%s_%s\"", version, hex.EncodeToString([]byte(varyHeaderValues)))
 }
 
+// generateStrongEtag builds a strong (non-weak) ETag from contentHash, the hex-encoded sha256
+// of an asset's uncompressed bytes. It still folds in varyHeaders the same way generateEtag
+// does, so a precompressed and an uncompressed response for the same asset still get distinct
+// ETags: the represented bytes genuinely differ, so the ETag must too.
+func generateStrongEtag(r *http.Request, contentHash string, varyHeaders []string) string {
+	varyHeaderValues := ""
+	for _, varyHeader := range varyHeaders {
+		varyHeaderValues += r.Header.Get(varyHeader)
+	}
+	return fmt.Sprintf("%q", contentHash+"_"+hex.EncodeToString([]byte(varyHeaderValues)))
+}
+
 type LongestToShortest []string
 
 func (s LongestToShortest) Len() int {
@@ -84,6 +503,27 @@ func (s LongestToShortest) Less(i, j int) bool {
 	return len(s[i]) > len(s[j])
 }
 
+// ExtensionResource describes one script or stylesheet the console injects into index.html.
+type ExtensionResource struct {
+	// URL is the location to load the resource from.
+	URL string
+	// Integrity, if set, pins the expected sha384 Subresource Integrity value for URL. The
+	// server reads URL once at startup (over HTTP for a remote URL, or straight from the
+	// asset bundle for a same-origin/local one) to confirm it still matches and refuses to
+	// start if it doesn't, guarding against a compromised or silently altered extension
+	// host. If unset and URL is same-origin/local, the integrity value is instead computed
+	// from that same one-time read, with no pinning guarantee: a later change to the
+	// extension is picked up, not rejected. If unset and URL is remote, no integrity
+	// attribute is rendered at all: auto-pinning a CDN-hosted script to whatever bytes it
+	// happened to serve at startup would make the browser refuse it the next time that CDN
+	// legitimately updates.
+	Integrity string
+	// CrossOrigin sets the crossorigin attribute rendered alongside Integrity. Defaults to
+	// "anonymous" when empty, since that's what the integrity check itself requires for a
+	// cross-origin URL.
+	CrossOrigin string
+}
+
 // HTML5ModeHandler will serve any static assets we know about, all other paths
 // are assumed to be HTML5 paths for the console application and index.html will
 // be served.
@@ -91,9 +531,24 @@ func (s LongestToShortest) Less(i, j int) bool {
 //
 // subcontextMap is a map of keys (subcontexts, no leading or trailing slashes) to the asset path (no
 // leading slash) to serve for that subcontext if a resource that does not exist is requested
-func HTML5ModeHandler(contextRoot string, subcontextMap map[string]string, extensionScripts []string, extensionStylesheets []string, version string, h http.Handler, getAsset AssetFunc) (http.Handler, error) {
+//
+// cspTemplate, if non-empty, is a Content-Security-Policy value with its <extension-origins>
+// and <api-origins> placeholders already substituted (see BuildContentSecurityPolicyTemplate)
+// and a {{nonce}} placeholder still present. Every <script>/<style> tag rendered here gets a
+// matching nonce attribute placeholder, and both are replaced with a fresh nonce on every
+// index.html response. An empty cspTemplate disables the Content-Security-Policy header
+// entirely.
+//
+// assetCache, if non-nil, is consulted for every requested path that exists in the asset
+// bundle: a hit gets a strong ETag derived from that asset's content hash and a
+// long-lived, immutable Cache-Control, since a bundled asset's fingerprinted filename only
+// ever points at one set of bytes. A miss (including every dynamic index.html fallback,
+// which isn't in assetCache) keeps the existing weak, version-derived ETag instead. A nil
+// assetCache falls back to the weak ETag for everything, as before.
+func HTML5ModeHandler(contextRoot string, subcontextMap map[string]string, extensionScripts []ExtensionResource, extensionStylesheets []ExtensionResource, version string, h http.Handler, getAsset AssetFunc, cspTemplate string, assetCache PrecompressedAssetCache) (http.Handler, error) {
 	subcontextData := map[string][]byte{}
 	subcontexts := []string{}
+	builtAt := time.Now()
 
 	for subcontext, index := range subcontextMap {
 		b, err := getAsset(index)
@@ -110,13 +565,25 @@ func HTML5ModeHandler(contextRoot string, subcontextMap map[string]string, exten
 		// Inject extension scripts and stylesheets, but only for the console itself, which has an empty subcontext
 		if len(subcontext) == 0 {
 			if len(extensionScripts) > 0 {
-				b = addExtensionScripts(b, extensionScripts)
+				scriptIntegrity, err := sriHashesFor(getAsset, extensionScripts)
+				if err != nil {
+					return nil, err
+				}
+				b = addExtensionScripts(b, extensionScripts, scriptIntegrity)
 			}
 			if len(extensionStylesheets) > 0 {
-				b = addExtensionStylesheets(b, extensionStylesheets)
+				stylesheetIntegrity, err := sriHashesFor(getAsset, extensionStylesheets)
+				if err != nil {
+					return nil, err
+				}
+				b = addExtensionStylesheets(b, extensionStylesheets, stylesheetIntegrity)
 			}
 		}
 
+		if len(cspTemplate) > 0 {
+			b = injectNonceAttrs(b)
+		}
+
 		subcontextData[subcontext] = b
 		subcontexts = append(subcontexts, subcontext)
 	}
@@ -134,26 +601,83 @@ func HTML5ModeHandler(contextRoot string, subcontextMap map[string]string, exten
 					prefix += "/"
 				}
 				if urlPath == subcontext || strings.HasPrefix(urlPath, prefix) {
+					metrics.HTML5FallbackCount.Inc()
+					audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/html5-fallback-path", urlPath)
+					if len(subcontext) == 0 {
+						for _, script := range extensionScripts {
+							audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/extension-script", script.URL)
+						}
+						for _, stylesheet := range extensionStylesheets {
+							audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/extension-stylesheet", stylesheet.URL)
+						}
+					}
 					// This is dynamic content since the extensions can change the HTML. Don't cache.
 					w.Header().Add("Cache-Control", "no-cache, no-store")
-					w.Write(subcontextData[subcontext])
+					body := subcontextData[subcontext]
+					if len(cspTemplate) > 0 {
+						nonce, err := GenerateNonce()
+						if err != nil {
+							// Fail open: serve the page without a CSP rather than fail the
+							// request over a broken entropy source. The unreplaced nonce
+							// placeholder is inert without a matching CSP nonce-source.
+							utilruntime.HandleError(fmt.Errorf("error generating Content-Security-Policy nonce: %v", err))
+						} else {
+							body = renderNonce(body, nonce)
+							w.Header().Set("Content-Security-Policy", renderContentSecurityPolicy(cspTemplate, nonce))
+						}
+					}
+					w.Write(body)
 					return
 				}
 			}
 		}
 
-		// Only handle ETags for content that won't change. The index.html responses can have scripts and stylesheets injected.
 		vary := w.Header().Get("Vary")
 		varyHeaders := []string{}
 		if vary != "" {
 			varyHeaders = varyHeaderRegexp.Split(vary, -1)
 		}
+
+		// A path present in assetCache is an immutable, fingerprinted asset: its filename
+		// changes whenever its content does, so the content itself never changes at this
+		// URL and can be cached forever with a strong, content-derived ETag. Everything
+		// else (chiefly the dynamic index.html fallback above, which returns before
+		// reaching here) keeps the weak, version-derived ETag below instead.
+		if entry, ok := assetCache[urlPath]; ok {
+			etag := generateStrongEtag(r, entry.ContentHash, varyHeaders)
+
+			if match := r.Header.Get("If-Match"); len(match) > 0 && match != "*" && match != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			if r.Header.Get("If-None-Match") == etag {
+				metrics.ETagCacheHitCount.WithLabelValues("true").Inc()
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			metrics.ETagCacheHitCount.WithLabelValues("false").Inc()
+
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			// The underlying asset file carries no real modification time, so setting
+			// Last-Modified here is what lets net/http.ServeContent (inside h, the
+			// wrapped http.FileServer) honor If-Modified-Since, Range and If-Range
+			// against it instead of leaving the header unset; ServeContent only sets
+			// its own Last-Modified when the file's ModTime is non-zero.
+			w.Header().Set("Last-Modified", builtAt.UTC().Format(http.TimeFormat))
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Only handle ETags for content that won't change. The index.html responses can have scripts and stylesheets injected.
 		etag := generateEtag(r, version, varyHeaders)
 
 		if r.Header.Get("If-None-Match") == etag {
+			metrics.ETagCacheHitCount.WithLabelValues("true").Inc()
 			w.WriteHeader(http.StatusNotModified)
 			return
 		}
+		metrics.ETagCacheHitCount.WithLabelValues("false").Inc()
 
 		// Clients must revalidate their cached copy every time.
 		w.Header().Add("Cache-Control", "public, max-age=0, must-revalidate")
@@ -162,11 +686,99 @@ func HTML5ModeHandler(contextRoot string, subcontextMap map[string]string, exten
 	}), nil
 }
 
-// Add the extension scripts as the last scripts, just before the body closing tag.
-func addExtensionScripts(content []byte, extensionScripts []string) []byte {
+// statusRecordingResponseWriter wraps an http.ResponseWriter to capture the status code the
+// wrapped handler ultimately writes, so a caller further out can label a metric with the real
+// response code instead of assuming success.
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecordingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// statusCode returns the status code the wrapped handler wrote, or http.StatusOK if it never
+// called WriteHeader explicitly (the same default net/http itself applies on the first Write).
+func (w *statusRecordingResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// AssetRequestCountHandler wraps h, the fully assembled asset handler chain, to record every
+// request in metrics.AssetRequestCount broken out by subcontext and h's real response status
+// code. subcontextMap and the extension resource lists should be the same ones HTML5ModeHandler
+// was built with, so a request is labeled the same way: metrics.SubcontextScript for a
+// same-origin extension script/stylesheet, its subcontextMap key for anything else recognized,
+// and metrics.SubcontextConsole otherwise.
+//
+// This wraps the outermost handler rather than reaching into HTML5ModeHandler or
+// PrecompressedAssetHandler individually, since either one of those can be the one that
+// actually serves a given request depending on Accept-Encoding.
+func AssetRequestCountHandler(subcontextMap map[string]string, extensionScripts, extensionStylesheets []ExtensionResource, h http.Handler) http.Handler {
+	extensionPaths := map[string]bool{}
+	for _, resource := range extensionScripts {
+		addLocalResourcePath(extensionPaths, resource.URL)
+	}
+	for _, resource := range extensionStylesheets {
+		addLocalResourcePath(extensionPaths, resource.URL)
+	}
+
+	subcontexts := []string{}
+	for subcontext := range subcontextMap {
+		subcontexts = append(subcontexts, subcontext)
+	}
+	sort.Sort(LongestToShortest(subcontexts))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := strings.TrimPrefix(r.URL.Path, "/")
+
+		subcontext := metrics.SubcontextConsole
+		switch {
+		case extensionPaths[urlPath]:
+			subcontext = metrics.SubcontextScript
+		default:
+			for _, sc := range subcontexts {
+				if len(sc) == 0 {
+					continue
+				}
+				if urlPath == sc || strings.HasPrefix(urlPath, sc+"/") {
+					subcontext = sc
+					break
+				}
+			}
+		}
+
+		recorder := &statusRecordingResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(recorder, r)
+		metrics.AssetRequestCount.WithLabelValues(subcontext, strconv.Itoa(recorder.statusCode())).Inc()
+	})
+}
+
+// addLocalResourcePath records rawURL's path in paths if rawURL is same-origin/local, so
+// AssetRequestCountHandler can recognize a request for it as an extension resource rather than
+// whatever subcontext its path happens to fall under.
+func addLocalResourcePath(paths map[string]bool, rawURL string) {
+	if !isLocalResource(rawURL) {
+		return
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	paths[strings.TrimPrefix(parsed.Path, "/")] = true
+}
+
+// Add the extension scripts as the last scripts, just before the body closing tag. A
+// script whose URL has an entry in integrity gets an integrity/crossorigin attribute so
+// the browser refuses to execute it if the extension host is compromised.
+func addExtensionScripts(content []byte, extensionScripts []ExtensionResource, integrity map[string]string) []byte {
 	var scriptTags bytes.Buffer
-	for _, scriptURL := range extensionScripts {
-		scriptTags.WriteString(fmt.Sprintf("<script src=\"%s\"></script>\n", html.EscapeString(scriptURL)))
+	for _, script := range extensionScripts {
+		scriptTags.WriteString(fmt.Sprintf("<script src=\"%s\"%s></script>\n", html.EscapeString(script.URL), integrityAttrs(script, integrity[script.URL])))
 	}
 
 	replaceBefore := []byte("</body>")
@@ -175,10 +787,12 @@ func addExtensionScripts(content []byte, extensionScripts []string) []byte {
 }
 
 // Add the extension stylesheets as the last stylesheets, just before the head closing tag.
-func addExtensionStylesheets(content []byte, extensionStylesheets []string) []byte {
+// A stylesheet whose URL has an entry in integrity gets an integrity/crossorigin attribute
+// so the browser refuses to apply it if the extension host is compromised.
+func addExtensionStylesheets(content []byte, extensionStylesheets []ExtensionResource, integrity map[string]string) []byte {
 	var styleTags bytes.Buffer
-	for _, stylesheetURL := range extensionStylesheets {
-		styleTags.WriteString(fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s\">\n", html.EscapeString(stylesheetURL)))
+	for _, stylesheet := range extensionStylesheets {
+		styleTags.WriteString(fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s\"%s>\n", html.EscapeString(stylesheet.URL), integrityAttrs(stylesheet, integrity[stylesheet.URL])))
 	}
 
 	replaceBefore := []byte("</head>")
@@ -186,6 +800,19 @@ func addExtensionStylesheets(content []byte, extensionStylesheets []string) []by
 	return bytes.Replace(content, replaceBefore, styleTags.Bytes(), 1)
 }
 
+// integrityAttrs renders the integrity/crossorigin attributes for a tag, or the empty
+// string if hash is empty (e.g. because it couldn't be computed and wasn't pinned).
+func integrityAttrs(resource ExtensionResource, hash string) string {
+	if len(hash) == 0 {
+		return ""
+	}
+	crossOrigin := resource.CrossOrigin
+	if len(crossOrigin) == 0 {
+		crossOrigin = "anonymous"
+	}
+	return fmt.Sprintf(" integrity=\"%s\" crossorigin=\"%s\"", html.EscapeString(hash), html.EscapeString(crossOrigin))
+}
+
 var versionTemplate = template.Must(template.New("webConsoleVersion").Parse(`
 window.OPENSHIFT_VERSION = {
   console: "{{ .ConsoleVersion | js }}"
@@ -231,6 +858,8 @@ window.OPENSHIFT_CONFIG = {
   auth: {
   	oauth_authorize_uri: "{{ .OAuthAuthorizeURI | js}}",
 	oauth_token_uri: "{{ .OAuthTokenURI | js}}",
+	oauth_jwks_uri: "{{ .OAuthJWKSURI | js}}",
+	oauth_end_session_endpoint: "{{ .OAuthEndSessionEndpoint | js}}",
   	oauth_redirect_base: "{{ .OAuthRedirectBase | js}}",
   	oauth_client_id: "{{ .OAuthClientID | js}}",
   	logout_uri: "{{ .LogoutURI | js}}"
@@ -269,6 +898,13 @@ type WebConsoleConfig struct {
 	OAuthAuthorizeURI string
 	// OAuthTokenURI is the OAuth2 endpoint to use to request an API token. If set, the OAuthClientID must support a client_secret of "".
 	OAuthTokenURI string
+	// OAuthJWKSURI is the external OIDC issuer's JSON Web Key Set endpoint, for consumers
+	// that need to verify ID token signatures themselves. Empty when OAuthDiscoverySource
+	// is "master", since the kube master's metadata endpoint doesn't publish one.
+	OAuthJWKSURI string
+	// OAuthEndSessionEndpoint is the external OIDC issuer's RP-Initiated Logout endpoint.
+	// Empty when OAuthDiscoverySource is "master".
+	OAuthEndSessionEndpoint string
 	// OAuthRedirectBase is the base URI of the web console. It must be a valid redirect_uri for the OAuthClientID
 	OAuthRedirectBase string
 	// OAuthClientID is the OAuth2 client_id to use to request an API token. It must be authorized to redirect to the web console URL.
@@ -295,6 +931,10 @@ type WebConsoleConfig struct {
 	// and skip validation on those fields. The memory limit field will still be displayed.
 	ClusterResourceOverridesEnabled bool
 	AdminConsoleURL                 string
+	// OAuthDiscoverySource records where OAuthAuthorizeURI/OAuthTokenURI came from
+	// ("master" or "oidc-issuer"); it is only used to annotate config.js and config.json audit events
+	// and is never rendered into the template.
+	OAuthDiscoverySource string
 }
 
 // ClusterResourceOverrideConfig is the configuration for the ClusterResourceOverride
@@ -314,7 +954,12 @@ type ClusterResourceOverrideConfig struct {
 	MemoryRequestToLimitPercent int64
 }
 
-func GeneratedConfigHandler(config WebConsoleConfig, version WebConsoleVersion, extensionProps WebConsoleExtensionProperties) (http.Handler, error) {
+// cspTemplate, if non-empty, is set as the Content-Security-Policy header on every response.
+// config.js has no inline scripts or styles of its own, so it doesn't need a nonce; its
+// {{nonce}} placeholder (if any) is left unsubstituted since a browser ignores an unmatched
+// nonce-source rather than erroring on it. This just gives the response the same policy as
+// index.html in case it's ever fetched or navigated to on its own.
+func GeneratedConfigHandler(config WebConsoleConfig, version WebConsoleVersion, extensionProps WebConsoleExtensionProperties, cspTemplate string) (http.Handler, error) {
 	var buffer bytes.Buffer
 	if err := configTemplate.Execute(&buffer, config); err != nil {
 		return nil, err
@@ -331,10 +976,116 @@ func GeneratedConfigHandler(config WebConsoleConfig, version WebConsoleVersion,
 	content := buffer.Bytes()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.AssetRequestCount.WithLabelValues(metrics.SubcontextConfig, "200").Inc()
+		audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/oauth-client-id", config.OAuthClientID)
+		audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/inactivity-timeout-minutes", fmt.Sprintf("%d", config.InactivityTimeoutMinutes))
+		audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/oauth-discovery-source", config.OAuthDiscoverySource)
 		w.Header().Add("Cache-Control", "no-cache, no-store")
 		w.Header().Add("Content-Type", "application/javascript")
+		if len(cspTemplate) > 0 {
+			w.Header().Set("Content-Security-Policy", cspTemplate)
+		}
 		if _, err := w.Write(content); err != nil {
 			utilruntime.HandleError(fmt.Errorf("Error serving Web Console config and version: %v", err))
 		}
 	}), nil
 }
+
+// webConsoleConfigJSON is the JSON-serializable form of the same data GeneratedConfigHandler
+// renders into config.js, for GeneratedConfigJSONHandler's config.json companion endpoint.
+// Field names and nesting mirror the window.OPENSHIFT_CONFIG object configTemplate produces,
+// so the SPA can treat both as the same shape.
+type webConsoleConfigJSON struct {
+	APIs struct {
+		HostPort string `json:"hostPort"`
+		Prefix   string `json:"prefix"`
+	} `json:"apis"`
+	API struct {
+		OpenShift struct {
+			HostPort string `json:"hostPort"`
+			Prefix   string `json:"prefix"`
+		} `json:"openshift"`
+		Kubernetes struct {
+			HostPort string `json:"hostPort"`
+			Prefix   string `json:"prefix"`
+		} `json:"k8s"`
+	} `json:"api"`
+	Auth struct {
+		OAuthAuthorizeURI       string `json:"oauth_authorize_uri"`
+		OAuthTokenURI           string `json:"oauth_token_uri"`
+		OAuthJWKSURI            string `json:"oauth_jwks_uri"`
+		OAuthEndSessionEndpoint string `json:"oauth_end_session_endpoint"`
+		OAuthRedirectBase       string `json:"oauth_redirect_base"`
+		OAuthClientID           string `json:"oauth_client_id"`
+		LogoutURI               string `json:"logout_uri"`
+	} `json:"auth"`
+	LimitRequestOverrides           *ClusterResourceOverrideConfig `json:"limitRequestOverrides,omitempty"`
+	AdminConsoleURL                 string                         `json:"adminConsoleURL"`
+	LoggingURL                      string                         `json:"loggingURL"`
+	MetricsURL                      string                         `json:"metricsURL"`
+	TemplateServiceBrokerEnabled    bool                           `json:"templateServiceBrokerEnabled"`
+	InactivityTimeoutMinutes        int64                          `json:"inactivityTimeoutMinutes"`
+	ClusterResourceOverridesEnabled bool                           `json:"clusterResourceOverridesEnabled"`
+	ConsoleVersion                  string                         `json:"consoleVersion"`
+	ExtensionProperties             map[string]string              `json:"extensionProperties"`
+}
+
+// buildWebConsoleConfigJSON assembles the config.json payload from the same inputs
+// GeneratedConfigHandler renders into config.js.
+func buildWebConsoleConfigJSON(config WebConsoleConfig, version WebConsoleVersion, extensionProps WebConsoleExtensionProperties) webConsoleConfigJSON {
+	payload := webConsoleConfigJSON{}
+	payload.APIs.HostPort = config.APIGroupAddr
+	payload.APIs.Prefix = config.APIGroupPrefix
+	payload.API.OpenShift.HostPort = config.MasterAddr
+	payload.API.OpenShift.Prefix = config.MasterPrefix
+	payload.API.Kubernetes.HostPort = config.KubernetesAddr
+	payload.API.Kubernetes.Prefix = config.KubernetesPrefix
+	payload.Auth.OAuthAuthorizeURI = config.OAuthAuthorizeURI
+	payload.Auth.OAuthTokenURI = config.OAuthTokenURI
+	payload.Auth.OAuthJWKSURI = config.OAuthJWKSURI
+	payload.Auth.OAuthEndSessionEndpoint = config.OAuthEndSessionEndpoint
+	payload.Auth.OAuthRedirectBase = config.OAuthRedirectBase
+	payload.Auth.OAuthClientID = config.OAuthClientID
+	payload.Auth.LogoutURI = config.LogoutURI
+	payload.LimitRequestOverrides = config.LimitRequestOverrides
+	payload.AdminConsoleURL = config.AdminConsoleURL
+	payload.LoggingURL = config.LoggingURL
+	payload.MetricsURL = config.MetricsURL
+	payload.TemplateServiceBrokerEnabled = config.TemplateServiceBrokerEnabled
+	payload.InactivityTimeoutMinutes = config.InactivityTimeoutMinutes
+	payload.ClusterResourceOverridesEnabled = config.ClusterResourceOverridesEnabled
+	payload.ConsoleVersion = version.ConsoleVersion
+
+	payload.ExtensionProperties = make(map[string]string, len(extensionProps.ExtensionProperties))
+	for _, property := range extensionProps.ExtensionProperties {
+		payload.ExtensionProperties[property.Key] = property.Value
+	}
+
+	return payload
+}
+
+// GeneratedConfigJSONHandler serves the same data as GeneratedConfigHandler's config.js, as a
+// config.json document instead of a window.OPENSHIFT_CONFIG assignment. It exists so the SPA
+// can refetch and diff the running config (e.g. on window focus/visibility change) without
+// reloading the page the way picking up a changed config.js requires.
+func GeneratedConfigJSONHandler(config WebConsoleConfig, version WebConsoleVersion, extensionProps WebConsoleExtensionProperties, cspTemplate string) (http.Handler, error) {
+	content, err := json.Marshal(buildWebConsoleConfigJSON(config, version, extensionProps))
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.AssetRequestCount.WithLabelValues(metrics.SubcontextConfigJSON, "200").Inc()
+		audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/oauth-client-id", config.OAuthClientID)
+		audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/inactivity-timeout-minutes", fmt.Sprintf("%d", config.InactivityTimeoutMinutes))
+		audit.AddAuditAnnotation(r.Context(), "webconsole.openshift.io/oauth-discovery-source", config.OAuthDiscoverySource)
+		w.Header().Add("Cache-Control", "no-cache, no-store")
+		w.Header().Set("Content-Type", "application/json")
+		if len(cspTemplate) > 0 {
+			w.Header().Set("Content-Security-Policy", cspTemplate)
+		}
+		if _, err := w.Write(content); err != nil {
+			utilruntime.HandleError(fmt.Errorf("Error serving Web Console config as JSON: %v", err))
+		}
+	}), nil
+}
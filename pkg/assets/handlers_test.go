@@ -2,12 +2,21 @@ package assets
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/openshift/origin-web-console-server/pkg/assets/metrics"
 )
 
 func stubHandler(response string) http.Handler {
@@ -19,7 +28,7 @@ func stubHandler(response string) http.Handler {
 }
 
 func TestWebConsoleConfigTemplate(t *testing.T) {
-	handler, err := GeneratedConfigHandler(WebConsoleConfig{}, WebConsoleVersion{}, WebConsoleExtensionProperties{})
+	handler, err := GeneratedConfigHandler(WebConsoleConfig{}, WebConsoleVersion{}, WebConsoleExtensionProperties{}, "")
 	if err != nil {
 		t.Fatalf("expected a handler, got error %v", err)
 	}
@@ -37,6 +46,47 @@ func TestWebConsoleConfigTemplate(t *testing.T) {
 	}
 }
 
+func TestWebConsoleConfigJSONHandler(t *testing.T) {
+	config := WebConsoleConfig{
+		AdminConsoleURL:          "https://admin.example.com",
+		OAuthClientID:            "openshift-web-console",
+		LoggingURL:               "https://logging.example.com",
+		MetricsURL:               "https://metrics.example.com",
+		InactivityTimeoutMinutes: 15,
+	}
+	extensionProps := WebConsoleExtensionProperties{
+		ExtensionProperties: []WebConsoleExtensionProperty{{Key: "foo", Value: "bar"}},
+	}
+
+	handler, err := GeneratedConfigJSONHandler(config, WebConsoleVersion{ConsoleVersion: "v1"}, extensionProps, "")
+	if err != nil {
+		t.Fatalf("expected a handler, got error %v", err)
+	}
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, &http.Request{Method: "GET"})
+	if ct := writer.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected Content-Type application/json, got %q", ct)
+	}
+
+	var decoded webConsoleConfigJSON
+	if err := json.Unmarshal(writer.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid JSON, got error %v: %s", err, writer.Body.String())
+	}
+	if decoded.AdminConsoleURL != config.AdminConsoleURL {
+		t.Errorf("expected adminConsoleURL %q, got %q", config.AdminConsoleURL, decoded.AdminConsoleURL)
+	}
+	if decoded.Auth.OAuthClientID != config.OAuthClientID {
+		t.Errorf("expected auth.oauth_client_id %q, got %q", config.OAuthClientID, decoded.Auth.OAuthClientID)
+	}
+	if decoded.ConsoleVersion != "v1" {
+		t.Errorf("expected consoleVersion %q, got %q", "v1", decoded.ConsoleVersion)
+	}
+	if decoded.ExtensionProperties["foo"] != "bar" {
+		t.Errorf("expected extensionProperties.foo %q, got %q", "bar", decoded.ExtensionProperties["foo"])
+	}
+}
+
 func TestWithoutGzip(t *testing.T) {
 	const resp = "hello"
 	handler := GzipHandler(stubHandler(resp))
@@ -74,8 +124,25 @@ func TestWithoutGzipWithMultipleVaryHeaders(t *testing.T) {
 	}
 }
 
+// compressibleTestBody is a text/plain body past minCompressibleResponseSize, so tests that
+// want to exercise actual compression don't fall afoul of it the way a bare "hello" would.
+var compressibleTestBody = strings.Repeat("hello ", minCompressibleResponseSize)
+
+func gunzip(t *testing.T, b []byte) string {
+	t.Helper()
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("expected valid gzip bytes, got error %v", err)
+	}
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected valid gzip bytes, got error %v", err)
+	}
+	return string(decoded)
+}
+
 func TestWithGzip(t *testing.T) {
-	handler := GzipHandler(stubHandler("hello"))
+	handler := GzipHandler(stubHandler(compressibleTestBody))
 	writer := httptest.NewRecorder()
 	handler.ServeHTTP(writer, &http.Request{
 		Method: "GET",
@@ -86,8 +153,11 @@ func TestWithGzip(t *testing.T) {
 	if writer.Body == nil {
 		t.Fatal("expected a body")
 	}
-	if l := writer.Body.Len(); l != 29 {
-		t.Fatalf("invalid body length, got %d", l)
+	if enc := writer.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip, got %q", enc)
+	}
+	if got := gunzip(t, writer.Body.Bytes()); got != compressibleTestBody {
+		t.Fatalf("expected decoded body %q, got %q", compressibleTestBody, got)
 	}
 	vary := writer.Header()["Vary"]
 	if !reflect.DeepEqual(vary, []string{"Accept-Encoding"}) {
@@ -98,7 +168,7 @@ func TestWithGzip(t *testing.T) {
 func TestWithGzipAndMultipleVaryHeader(t *testing.T) {
 	handler := GzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Foo")
-		w.Write([]byte("hello"))
+		w.Write([]byte(compressibleTestBody))
 	}))
 	writer := httptest.NewRecorder()
 	handler.ServeHTTP(writer, &http.Request{
@@ -110,8 +180,8 @@ func TestWithGzipAndMultipleVaryHeader(t *testing.T) {
 	if writer.Body == nil {
 		t.Fatal("expected a body")
 	}
-	if l := writer.Body.Len(); l != 29 {
-		t.Fatalf("invalid body length, got %d", l)
+	if got := gunzip(t, writer.Body.Bytes()); got != compressibleTestBody {
+		t.Fatalf("expected decoded body %q, got %q", compressibleTestBody, got)
 	}
 	vary := writer.Header()["Vary"]
 	if !reflect.DeepEqual(vary, []string{"Accept-Encoding", "Foo"}) {
@@ -120,7 +190,7 @@ func TestWithGzipAndMultipleVaryHeader(t *testing.T) {
 }
 
 func TestWithGzipReal(t *testing.T) {
-	const raw = "hello"
+	raw := compressibleTestBody
 	handler := GzipHandler(stubHandler(raw))
 	server := httptest.NewServer(handler)
 	defer server.Close()
@@ -130,6 +200,10 @@ func TestWithGzipReal(t *testing.T) {
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed reading body: %s", err)
+	}
+	// http.Get's underlying Transport asks for and transparently decodes gzip itself.
 	if string(body) != raw {
 		t.Fatalf(`did not find expected "%s" but got "%s" instead`, raw, string(body))
 	}
@@ -140,7 +214,7 @@ func TestWithGzipReal(t *testing.T) {
 }
 
 func TestWithGzipRealAndMultipleVaryHeaders(t *testing.T) {
-	const raw = "hello"
+	raw := compressibleTestBody
 	handler := GzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Foo")
 		w.Write([]byte(raw))
@@ -153,6 +227,9 @@ func TestWithGzipRealAndMultipleVaryHeaders(t *testing.T) {
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed reading body: %s", err)
+	}
 	if string(body) != raw {
 		t.Fatalf(`did not find expected "%s" but got "%s" instead`, raw, string(body))
 	}
@@ -178,8 +255,94 @@ func TestWithGzipDoubleWrite(t *testing.T) {
 	if writer.Body == nil {
 		t.Fatal("expected a body")
 	}
-	if l := writer.Body.Len(); l != 54 {
-		t.Fatalf("invalid body length, got %d", l)
+	expected := strings.Repeat("foo", 1000) + strings.Repeat("bar", 1000)
+	if got := gunzip(t, writer.Body.Bytes()); got != expected {
+		t.Fatalf("expected decoded body %q, got %q", expected, got)
+	}
+}
+
+func TestWithGzipBelowThreshold(t *testing.T) {
+	handler := GzipHandler(stubHandler("hello"))
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, &http.Request{
+		Method: "GET",
+		Header: http.Header{
+			"Accept-Encoding": []string{"gzip"},
+		},
+	})
+	if enc := writer.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("expected no Content-Encoding for a body under minCompressibleResponseSize, got %q", enc)
+	}
+	if got := writer.Body.String(); got != "hello" {
+		t.Fatalf("expected uncompressed body %q, got %q", "hello", got)
+	}
+}
+
+func TestWithGzipNonCompressibleContentType(t *testing.T) {
+	handler := GzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(compressibleTestBody))
+	}))
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, &http.Request{
+		Method: "GET",
+		Header: http.Header{
+			"Accept-Encoding": []string{"gzip"},
+		},
+	})
+	if enc := writer.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("expected no Content-Encoding for a non-allowlisted Content-Type, got %q", enc)
+	}
+	if got := writer.Body.String(); got != compressibleTestBody {
+		t.Fatalf("expected uncompressed body %q, got %q", compressibleTestBody, got)
+	}
+}
+
+func TestIsCompressibleContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    bool
+	}{
+		{contentType: "text/html; charset=utf-8", expected: true},
+		{contentType: "application/javascript", expected: true},
+		{contentType: "application/json", expected: true},
+		{contentType: "image/svg+xml", expected: true},
+		{contentType: "image/png", expected: false},
+		{contentType: "font/woff2", expected: false},
+		{contentType: "", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.contentType, func(t *testing.T) {
+			if got := isCompressibleContentType(test.contentType); got != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		expected       string
+	}{
+		{name: "no header", acceptEncoding: "", expected: ""},
+		{name: "plain gzip", acceptEncoding: "gzip", expected: "gzip"},
+		{name: "prefers zstd over br and gzip", acceptEncoding: "gzip, br, zstd", expected: "zstd"},
+		{name: "prefers br over gzip", acceptEncoding: "gzip, br", expected: "br"},
+		{name: "explicit q=0 refuses gzip", acceptEncoding: "gzip;q=0", expected: ""},
+		{name: "explicit q=0 skips br in favor of gzip", acceptEncoding: "br;q=0, gzip", expected: "gzip"},
+		{name: "zero-weighted zstd falls through to br", acceptEncoding: "zstd;q=0, br, gzip", expected: "br"},
+		{name: "wildcard permits an unlisted coding", acceptEncoding: "*;q=1", expected: "zstd"},
+		{name: "wildcard q=0 permits nothing", acceptEncoding: "*;q=0", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := negotiateEncoding(test.acceptEncoding); got != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, got)
+			}
+		})
 	}
 }
 
@@ -216,11 +379,13 @@ func makeHTML5ModeHandler() (http.Handler, error) {
 	return HTML5ModeHandler(
 		"/console/",
 		subcontextMap,
-		[]string{},
-		[]string{},
+		nil,
+		nil,
 		"1234",
 		stubHandler(""),
 		Asset,
+		"",
+		nil,
 	)
 }
 
@@ -346,6 +511,76 @@ func TestETagGzip(t *testing.T) {
 	}
 }
 
+func TestStaticAssetStrongEtag(t *testing.T) {
+	content := []byte("console.log('hello, console');")
+	getAsset := fakeAssetFunc(map[string][]byte{
+		"index.html":        []byte(`<html><head></head><body></body></html>`),
+		"scripts/vendor.js": content,
+	})
+	assetCache, err := BuildPrecompressedAssetCache(getAsset, []string{"scripts/vendor.js"})
+	if err != nil {
+		t.Fatalf("expected no error building the asset cache, got %v", err)
+	}
+
+	subcontextMap := map[string]string{"": "index.html"}
+	handler, err := HTML5ModeHandler(
+		"/console/",
+		subcontextMap,
+		nil,
+		nil,
+		"1234",
+		stubHandler("served"),
+		getAsset,
+		"",
+		assetCache,
+	)
+	if err != nil {
+		t.Fatalf("expected a handler, got error %v", err)
+	}
+
+	request, err := http.NewRequest("GET", "https://example.com/scripts/vendor.js", nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	etag := writer.Header().Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("expected a strong ETag, got %q", etag)
+	}
+	if cc := writer.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Fatalf("expected an immutable Cache-Control, got %q", cc)
+	}
+	if writer.Header().Get("Last-Modified") == "" {
+		t.Fatal("expected a Last-Modified header")
+	}
+
+	// A matching If-None-Match should short-circuit to 304.
+	request, err = http.NewRequest("GET", "https://example.com/scripts/vendor.js", nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	request.Header.Set("If-None-Match", etag)
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if writer.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 Not Modified for a matching If-None-Match, got %d", writer.Code)
+	}
+
+	// A stale If-Match should be rejected with 412 rather than served.
+	request, err = http.NewRequest("GET", "https://example.com/scripts/vendor.js", nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	request.Header.Set("If-Match", "\"some-other-etag\"")
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if writer.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 Precondition Failed for a mismatched If-Match, got %d", writer.Code)
+	}
+}
+
 func TestExtensions(t *testing.T) {
 	subcontextMap := map[string]string{
 		"": "index.html",
@@ -361,11 +596,13 @@ func TestExtensions(t *testing.T) {
 	handler, err := HTML5ModeHandler(
 		"/console/",
 		subcontextMap,
-		scripts,
-		stylesheets,
+		extensionResourcesFromURLs(scripts),
+		extensionResourcesFromURLs(stylesheets),
 		"1234",
 		stubHandler(""),
 		Asset,
+		"",
+		nil,
 	)
 	if err != nil {
 		t.Fatalf("expected a handler, got error %v", err)
@@ -400,3 +637,519 @@ func TestExtensions(t *testing.T) {
 		}
 	}
 }
+
+func extensionResourcesFromURLs(urls []string) []ExtensionResource {
+	resources := make([]ExtensionResource, 0, len(urls))
+	for _, url := range urls {
+		resources = append(resources, ExtensionResource{URL: url})
+	}
+	return resources
+}
+
+func TestExtensionScriptIntegrityAttrs(t *testing.T) {
+	subcontextMap := map[string]string{"": "index.html"}
+	handler, err := HTML5ModeHandler(
+		"/console/",
+		subcontextMap,
+		[]ExtensionResource{{URL: "https://extensions.example.com/scripts/menus.js", Integrity: "sha384-not-the-real-hash", CrossOrigin: "use-credentials"}},
+		nil,
+		"1234",
+		stubHandler(""),
+		Asset,
+		"",
+		nil,
+	)
+	if err == nil {
+		t.Fatal("expected a startup error because the pinned integrity can't be verified against an unreachable host")
+	}
+	if handler != nil {
+		t.Fatal("expected no handler to be returned alongside the error")
+	}
+}
+
+func TestExtensionScriptIntegrityAttrsRemoteUnpinned(t *testing.T) {
+	subcontextMap := map[string]string{"": "index.html"}
+	getAsset := fakeAssetFunc(map[string][]byte{
+		"index.html": []byte(`<html><head></head><body></body></html>`),
+	})
+
+	// No Integrity pinned on a remote URL, so no integrity attribute may be rendered for it:
+	// auto-computing an integrity value from a remote resource's current bytes would just pin
+	// the extension to whatever the CDN serves today.
+	handler, err := HTML5ModeHandler(
+		"/console/",
+		subcontextMap,
+		[]ExtensionResource{{URL: "https://extensions.example.com/scripts/menus.js"}},
+		nil,
+		"1234",
+		stubHandler(""),
+		getAsset,
+		"",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("expected a handler, got error %v", err)
+	}
+
+	writer := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", indexURL, nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	handler.ServeHTTP(writer, request)
+
+	if strings.Contains(writer.Body.String(), "integrity=") {
+		t.Fatalf("expected no integrity attribute for an unpinned remote resource, got body:\n%s", writer.Body.String())
+	}
+}
+
+func TestExtensionScriptIntegrityAttrsLocal(t *testing.T) {
+	subcontextMap := map[string]string{"": "index.html"}
+	scriptContent := []byte("console.log('menu');")
+	getAsset := fakeAssetFunc(map[string][]byte{
+		"index.html":                  []byte(`<html><head></head><body></body></html>`),
+		"extensions/scripts/menus.js": scriptContent,
+	})
+
+	handler, err := HTML5ModeHandler(
+		"/console/",
+		subcontextMap,
+		[]ExtensionResource{{URL: "/extensions/scripts/menus.js"}},
+		nil,
+		"1234",
+		stubHandler(""),
+		getAsset,
+		"",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("expected a handler, got error %v", err)
+	}
+
+	writer := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", indexURL, nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	handler.ServeHTTP(writer, request)
+
+	expectedHash, err := computeSRIHash(getAsset, "/extensions/scripts/menus.js")
+	if err != nil {
+		t.Fatalf("expected no error computing the expected hash, got %v", err)
+	}
+	if !strings.Contains(writer.Body.String(), fmt.Sprintf("integrity=\"%s\"", expectedHash)) {
+		t.Fatalf("expected the integrity hash %q read from the local asset bundle, got body:\n%s", expectedHash, writer.Body.String())
+	}
+}
+
+func fakeAssetFunc(files map[string][]byte) AssetFunc {
+	return func(name string) ([]byte, error) {
+		b, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("asset %s not found", name)
+		}
+		return b, nil
+	}
+}
+
+func TestBuildPrecompressedAssetCache(t *testing.T) {
+	content := []byte("console.log('hello, console');")
+	getAsset := fakeAssetFunc(map[string][]byte{"main.js": content})
+
+	cache, err := BuildPrecompressedAssetCache(getAsset, []string{"main.js"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entry, ok := cache["main.js"]
+	if !ok {
+		t.Fatal("expected an entry for main.js")
+	}
+	if entry.ContentType != http.DetectContentType(content) {
+		t.Fatalf("expected Content-Type %q, got %q", http.DetectContentType(content), entry.ContentType)
+	}
+
+	brReader := brotli.NewReader(bytes.NewReader(entry.Encoded["br"]))
+	brDecoded, err := ioutil.ReadAll(brReader)
+	if err != nil {
+		t.Fatalf("expected valid brotli bytes, got error %v", err)
+	}
+	if !bytes.Equal(brDecoded, content) {
+		t.Fatalf("expected decoded br bytes %q, got %q", content, brDecoded)
+	}
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(entry.Encoded["gzip"]))
+	if err != nil {
+		t.Fatalf("expected valid gzip bytes, got error %v", err)
+	}
+	gzDecoded, err := ioutil.ReadAll(gzReader)
+	if err != nil {
+		t.Fatalf("expected valid gzip bytes, got error %v", err)
+	}
+	if !bytes.Equal(gzDecoded, content) {
+		t.Fatalf("expected decoded gzip bytes %q, got %q", content, gzDecoded)
+	}
+
+	if _, err := BuildPrecompressedAssetCache(getAsset, []string{"missing.js"}); err == nil {
+		t.Fatal("expected an error for an asset that doesn't exist")
+	}
+}
+
+func TestPrecompressedAssetHandler(t *testing.T) {
+	brBytes := []byte("pretend-brotli-bytes")
+	gzBytes := []byte("pretend-gzip-bytes")
+	cache := PrecompressedAssetCache{
+		"main.js": PrecompressedAssetEntry{
+			ContentType: "application/javascript",
+			ContentHash: "deadbeef",
+			Encoded: map[string][]byte{
+				"br":   brBytes,
+				"gzip": gzBytes,
+			},
+		},
+	}
+
+	fallbackCalled := false
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalled = true
+		w.Write([]byte("uncompressed"))
+	})
+
+	handler := PrecompressedAssetHandler(cache, fallback)
+
+	brWriter := httptest.NewRecorder()
+	handler.ServeHTTP(brWriter, &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/main.js"},
+		Header: http.Header{"Accept-Encoding": []string{"br, gzip"}},
+	})
+	if !bytes.Equal(brWriter.Body.Bytes(), brBytes) {
+		t.Fatalf("expected bit-identical br bytes, got %q", brWriter.Body.String())
+	}
+	if enc := brWriter.Header().Get("Content-Encoding"); enc != "br" {
+		t.Fatalf("expected Content-Encoding br, got %q", enc)
+	}
+	if cc := brWriter.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Fatalf("expected an immutable, year-long Cache-Control, got %q", cc)
+	}
+	brEtag := brWriter.Header().Get("ETag")
+	if brEtag == "" {
+		t.Fatal("expected an ETag")
+	}
+
+	gzWriter := httptest.NewRecorder()
+	handler.ServeHTTP(gzWriter, &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/main.js"},
+		Header: http.Header{"Accept-Encoding": []string{"gzip"}},
+	})
+	if !bytes.Equal(gzWriter.Body.Bytes(), gzBytes) {
+		t.Fatalf("expected bit-identical gzip bytes, got %q", gzWriter.Body.String())
+	}
+	if enc := gzWriter.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip, got %q", enc)
+	}
+	if gzEtag := gzWriter.Header().Get("ETag"); gzEtag == brEtag {
+		t.Fatalf("expected different ETags per encoding, both were %q", gzEtag)
+	}
+
+	// A Range request against a precompressed asset should be honored, not just satisfied
+	// by re-sending the whole thing, so a resumed download of a large bundle doesn't restart
+	// from byte zero.
+	rangeWriter := httptest.NewRecorder()
+	handler.ServeHTTP(rangeWriter, &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/main.js"},
+		Header: http.Header{"Accept-Encoding": []string{"gzip"}, "Range": []string{"bytes=0-3"}},
+	})
+	if rangeWriter.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206 Partial Content, got %d", rangeWriter.Code)
+	}
+	if !bytes.Equal(rangeWriter.Body.Bytes(), gzBytes[:4]) {
+		t.Fatalf("expected the first 4 bytes of the gzip content, got %q", rangeWriter.Body.String())
+	}
+
+	// A conditional request whose If-None-Match already matches the strong ETag should be
+	// answered with 304 rather than re-sending the body.
+	condWriter := httptest.NewRecorder()
+	handler.ServeHTTP(condWriter, &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/main.js"},
+		Header: http.Header{"Accept-Encoding": []string{"gzip"}, "If-None-Match": []string{gzWriter.Header().Get("ETag")}},
+	})
+	if condWriter.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 Not Modified, got %d", condWriter.Code)
+	}
+
+	if fallbackCalled {
+		t.Fatal("fallback handler should not have been invoked when a precompressed asset exists")
+	}
+
+	// A client that explicitly refuses br (q=0) but still advertises gzip should get gzip,
+	// not br and not the uncompressed fallback.
+	refusedBrWriter := httptest.NewRecorder()
+	handler.ServeHTTP(refusedBrWriter, &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/main.js"},
+		Header: http.Header{"Accept-Encoding": []string{"br;q=0, gzip"}},
+	})
+	if !bytes.Equal(refusedBrWriter.Body.Bytes(), gzBytes) {
+		t.Fatalf("expected gzip bytes when br is refused, got %q", refusedBrWriter.Body.String())
+	}
+	if enc := refusedBrWriter.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip when br is refused, got %q", enc)
+	}
+	if fallbackCalled {
+		t.Fatal("fallback handler should not have been invoked when a refused encoding still leaves gzip available")
+	}
+
+	missWriter := httptest.NewRecorder()
+	handler.ServeHTTP(missWriter, &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/missing.js"},
+		Header: http.Header{"Accept-Encoding": []string{"br, gzip"}},
+	})
+	if !fallbackCalled {
+		t.Fatal("expected fallback handler to be invoked for an asset without a precompressed sibling")
+	}
+	if missWriter.Body.String() != "uncompressed" {
+		t.Fatalf("expected fallback body, got %q", missWriter.Body.String())
+	}
+}
+
+func TestIndexHtmlContentSecurityPolicyNonce(t *testing.T) {
+	subcontextMap := map[string]string{"": "index.html"}
+	cspTemplate := BuildContentSecurityPolicyTemplate(DefaultContentSecurityPolicy, nil, nil)
+	handler, err := HTML5ModeHandler(
+		"/console/",
+		subcontextMap,
+		nil,
+		nil,
+		"1234",
+		stubHandler(""),
+		Asset,
+		cspTemplate,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("expected a handler, got error %v", err)
+	}
+
+	requestIndex := func() (string, string) {
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", indexURL, nil)
+		if err != nil {
+			t.Fatalf("expected a request, got error %v", err)
+		}
+		handler.ServeHTTP(writer, request)
+		return writer.Header().Get("Content-Security-Policy"), writer.Body.String()
+	}
+
+	csp1, body1 := requestIndex()
+	if !strings.Contains(csp1, "default-src 'self'") {
+		t.Fatalf("expected a default-src directive, got %q", csp1)
+	}
+	if strings.Contains(csp1, "{{nonce}}") {
+		t.Fatalf("expected the nonce placeholder to be substituted, got %q", csp1)
+	}
+	if strings.Contains(csp1, "<extension-origins>") {
+		t.Fatalf("expected every <extension-origins> placeholder to be substituted, got %q", csp1)
+	}
+	if strings.Contains(body1, cspNoncePlaceholder) {
+		t.Fatal("expected the nonce placeholder in the body to be substituted")
+	}
+
+	csp2, _ := requestIndex()
+	if csp1 == csp2 {
+		t.Fatalf("expected a fresh nonce on every request, got the same policy twice: %q", csp1)
+	}
+}
+
+func TestSecurityHeadersHandler(t *testing.T) {
+	request, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+
+	writer := httptest.NewRecorder()
+	SecurityHeadersHandler(SecurityHeadersConfig{}, stubHandler("")).ServeHTTP(writer, request)
+	for _, header := range []string{"Strict-Transport-Security", "Cross-Origin-Opener-Policy", "Cross-Origin-Embedder-Policy", "Reporting-Endpoints", "Report-To"} {
+		if value := writer.Header().Get(header); len(value) > 0 {
+			t.Fatalf("expected %s to be unset by default, got %q", header, value)
+		}
+	}
+
+	config := SecurityHeadersConfig{
+		StrictTransportSecurity:   "max-age=31536000; includeSubDomains",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+		ReportingEndpoint:         "https://example.com/csp-report",
+	}
+	writer = httptest.NewRecorder()
+	SecurityHeadersHandler(config, stubHandler("")).ServeHTTP(writer, request)
+	if got := writer.Header().Get("Strict-Transport-Security"); got != config.StrictTransportSecurity {
+		t.Fatalf("expected Strict-Transport-Security %q, got %q", config.StrictTransportSecurity, got)
+	}
+	if got := writer.Header().Get("Cross-Origin-Opener-Policy"); got != config.CrossOriginOpenerPolicy {
+		t.Fatalf("expected Cross-Origin-Opener-Policy %q, got %q", config.CrossOriginOpenerPolicy, got)
+	}
+	if got := writer.Header().Get("Cross-Origin-Embedder-Policy"); got != config.CrossOriginEmbedderPolicy {
+		t.Fatalf("expected Cross-Origin-Embedder-Policy %q, got %q", config.CrossOriginEmbedderPolicy, got)
+	}
+	if got := writer.Header().Get("X-Frame-Options"); got != "DENY" {
+		t.Fatalf("expected the baseline X-Frame-Options header to still be set, got %q", got)
+	}
+	if got := writer.Header().Get("Reporting-Endpoints"); !strings.Contains(got, config.ReportingEndpoint) {
+		t.Fatalf("expected Reporting-Endpoints to reference %q, got %q", config.ReportingEndpoint, got)
+	}
+	if got := writer.Header().Get("Report-To"); !strings.Contains(got, config.ReportingEndpoint) {
+		t.Fatalf("expected Report-To to reference %q, got %q", config.ReportingEndpoint, got)
+	}
+}
+
+func TestCSPReportHandlerLegacy(t *testing.T) {
+	sink := &fakeReportSink{}
+	body := `{"csp-report":{"document-uri":"https://example.com/","violated-directive":"script-src","blocked-uri":"https://evil.example.com/a.js","disposition":"enforce"}}`
+	request, err := http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	request.Header.Set("Content-Type", "application/csp-report")
+
+	writer := httptest.NewRecorder()
+	CSPReportHandler(sink).ServeHTTP(writer, request)
+
+	if writer.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", writer.Code)
+	}
+	if len(sink.reports) != 1 {
+		t.Fatalf("expected exactly one report, got %d", len(sink.reports))
+	}
+	if sink.reports[0].ViolatedDirective != "script-src" || sink.reports[0].BlockedURI != "https://evil.example.com/a.js" {
+		t.Fatalf("unexpected report: %+v", sink.reports[0])
+	}
+}
+
+func TestCSPReportHandlerReportingAPI(t *testing.T) {
+	sink := &fakeReportSink{}
+	body := `[{"type":"csp-violation","body":{"documentURL":"https://example.com/","violatedDirective":"style-src","blockedURL":"inline","disposition":"report"}},{"type":"deprecation","body":{}}]`
+	request, err := http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	request.Header.Set("Content-Type", "application/reports+json")
+
+	writer := httptest.NewRecorder()
+	CSPReportHandler(sink).ServeHTTP(writer, request)
+
+	if writer.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", writer.Code)
+	}
+	if len(sink.reports) != 1 {
+		t.Fatalf("expected the non-csp-violation report to be skipped, got %d reports", len(sink.reports))
+	}
+	if sink.reports[0].ViolatedDirective != "style-src" {
+		t.Fatalf("unexpected report: %+v", sink.reports[0])
+	}
+}
+
+func TestCSPReportHandlerRejectsOversizedBody(t *testing.T) {
+	sink := &fakeReportSink{}
+	body := strings.Repeat("a", maxCSPReportBytes+1)
+	request, err := http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+	request.Header.Set("Content-Type", "application/csp-report")
+
+	writer := httptest.NewRecorder()
+	CSPReportHandler(sink).ServeHTTP(writer, request)
+
+	if writer.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 Request Entity Too Large, got %d", writer.Code)
+	}
+	if len(sink.reports) != 0 {
+		t.Fatalf("expected no reports forwarded for an oversized body, got %d", len(sink.reports))
+	}
+}
+
+func TestCSPReportHandlerRejectsNonPost(t *testing.T) {
+	sink := &fakeReportSink{}
+	request, err := http.NewRequest("GET", "/csp-report", nil)
+	if err != nil {
+		t.Fatalf("expected a request, got error %v", err)
+	}
+
+	writer := httptest.NewRecorder()
+	CSPReportHandler(sink).ServeHTTP(writer, request)
+
+	if writer.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 Method Not Allowed, got %d", writer.Code)
+	}
+}
+
+func TestMultiReportSink(t *testing.T) {
+	first := &fakeReportSink{}
+	second := &fakeReportSink{}
+	sinks := MultiReportSink{first, second}
+
+	report := CSPReport{ViolatedDirective: "script-src"}
+	sinks.Report(report)
+
+	if len(first.reports) != 1 || len(second.reports) != 1 {
+		t.Fatalf("expected both sinks to receive the report, got %d and %d", len(first.reports), len(second.reports))
+	}
+}
+
+func TestBlockedURIHost(t *testing.T) {
+	if got := blockedURIHost("https://evil.example.com/a.js"); got != "evil.example.com" {
+		t.Fatalf("expected evil.example.com, got %q", got)
+	}
+	if got := blockedURIHost("inline"); got != "inline" {
+		t.Fatalf("expected the non-URL value unchanged, got %q", got)
+	}
+}
+
+type fakeReportSink struct {
+	reports []CSPReport
+}
+
+func (s *fakeReportSink) Report(report CSPReport) {
+	s.reports = append(s.reports, report)
+}
+
+func TestAssetRequestCountHandler(t *testing.T) {
+	metrics.AssetRequestCount.Reset()
+
+	subcontextMap := map[string]string{
+		"":     "index.html",
+		"java": "java/index.html",
+	}
+	scripts := []ExtensionResource{{URL: "/extensions/foo.js"}, {URL: "https://cdn.example.com/bar.js"}}
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "missing.js") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := AssetRequestCountHandler(subcontextMap, scripts, nil, inner)
+
+	cases := []struct {
+		path       string
+		subcontext string
+		code       string
+	}{
+		{"/main.js", metrics.SubcontextConsole, "200"},
+		{"/java/main.js", metrics.SubcontextJava, "200"},
+		{"/extensions/foo.js", metrics.SubcontextScript, "200"},
+		{"/missing.js", metrics.SubcontextConsole, "404"},
+	}
+	for _, c := range cases {
+		handler.ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "GET", URL: &url.URL{Path: c.path}})
+		if got := testutil.ToFloat64(metrics.AssetRequestCount.WithLabelValues(c.subcontext, c.code)); got != 1 {
+			t.Errorf("path %s: expected %s/%s to be counted once, got %v", c.path, c.subcontext, c.code, got)
+		}
+	}
+}
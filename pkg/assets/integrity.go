@@ -0,0 +1,112 @@
+package assets
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// sriHashClient is used to fetch extension scripts/stylesheets once at handler-build time
+// (server start or config reload) in order to compute Subresource Integrity hashes for
+// them. It deliberately has a bounded timeout; a slow or unreachable extension host should
+// not hang startup indefinitely.
+var sriHashClient = &http.Client{Timeout: 10 * time.Second}
+
+// contentFor returns the raw bytes of rawURL. A same-origin/local URL (no scheme, e.g.
+// "/extensions/foo.js") is read directly from the asset bundle via getAsset instead of
+// round-tripping through HTTP, since that content is already in memory and fetching it back
+// from this same server would be redundant, and could even race the server not yet accepting
+// connections during its own startup. Anything else is fetched over HTTP as before.
+func contentFor(getAsset AssetFunc, rawURL string) ([]byte, error) {
+	if isLocalResource(rawURL) {
+		parsed, _ := url.Parse(rawURL)
+		content, err := getAsset(strings.TrimPrefix(parsed.Path, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading local extension resource %s: %v", rawURL, err)
+		}
+		return content, nil
+	}
+
+	resp, err := sriHashClient.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s to compute its integrity hash: %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s to compute its integrity hash: unexpected status %s", rawURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s to compute its integrity hash: %v", rawURL, err)
+	}
+	return body, nil
+}
+
+// isLocalResource reports whether rawURL is same-origin/local (no scheme, e.g.
+// "/extensions/foo.js") rather than an absolute URL pointing at a remote host.
+func isLocalResource(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && len(parsed.Scheme) == 0
+}
+
+// computeSRIHash returns rawURL's Subresource Integrity value using the sha384 algorithm,
+// e.g. "sha384-<base64>". See: https://www.w3.org/TR/SRI/#the-integrity-attribute
+func computeSRIHash(getAsset AssetFunc, rawURL string) (string, error) {
+	body, err := contentFor(getAsset, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha512.Sum384(body)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// sriHashesFor computes an integrity hash for each of resources, keyed by URL.
+//
+// A remote resource with no pinned Integrity is skipped entirely: it is never fetched and
+// gets no integrity attribute. Auto-computing one from whatever bytes the CDN happened to
+// serve at startup would silently pin the extension to that snapshot, so the next legitimate
+// update to the CDN-hosted script would make the browser refuse to run it.
+//
+// A same-origin/local resource with no pinned Integrity is best-effort: if its hash can't be
+// computed (missing from the asset bundle, etc.), that's logged and it's simply omitted from
+// the map, so the extension still loads without an integrity attribute rather than breaking
+// the console over that.
+//
+// A resource with a pinned Integrity, local or remote, is not best-effort: sriHashesFor
+// fetches it to confirm the pin still matches and returns an error instead of a silent
+// fallback if it doesn't, or if the host can't be reached at all. Silently ignoring a pin
+// mismatch would defeat the point of pinning it, so this is surfaced as a startup error by
+// every caller.
+func sriHashesFor(getAsset AssetFunc, resources []ExtensionResource) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, resource := range resources {
+		if len(resource.Integrity) == 0 && !isLocalResource(resource.URL) {
+			continue
+		}
+
+		hash, err := computeSRIHash(getAsset, resource.URL)
+		if err != nil {
+			if len(resource.Integrity) > 0 {
+				return nil, fmt.Errorf("could not verify pinned integrity for extension resource %s: %v", resource.URL, err)
+			}
+			glog.Warningf("could not compute integrity hash for extension resource: %v", err)
+			continue
+		}
+
+		if len(resource.Integrity) > 0 && hash != resource.Integrity {
+			return nil, fmt.Errorf("extension resource %s does not match its pinned integrity value: expected %s, got %s", resource.URL, resource.Integrity, hash)
+		}
+
+		hashes[resource.URL] = hash
+	}
+	return hashes, nil
+}
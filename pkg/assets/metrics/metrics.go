@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// subcontext labels the asset request counters the same way HTML5ModeHandler's
+// subcontextMap does: "" for the console itself, "java" for the legacy console.
+const (
+	SubcontextConsole    = ""
+	SubcontextJava       = "java"
+	SubcontextConfig     = "config.js"
+	SubcontextConfigJSON = "config.json"
+	SubcontextScript     = "extension-script"
+)
+
+var (
+	AssetRequestCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "openshift",
+		Subsystem: "asset_server",
+		Name:      "requests_total",
+		Help:      "Counter of asset server requests broken out by subcontext and status code.",
+	}, []string{"subcontext", "code"})
+
+	CompressionCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "openshift",
+		Subsystem: "asset_server",
+		Name:      "compressed_requests_total",
+		Help:      "Counter of asset server requests broken out by the content-encoding negotiated (gzip, br, zstd, or none).",
+	}, []string{"encoding"})
+
+	HTML5FallbackCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "openshift",
+		Subsystem: "asset_server",
+		Name:      "html5_fallback_total",
+		Help:      "Counter of requests served index.html because the requested asset did not exist (HTML5 mode).",
+	})
+
+	ETagCacheHitCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "openshift",
+		Subsystem: "asset_server",
+		Name:      "etag_cache_total",
+		Help:      "Counter of cacheable asset requests broken out by whether the client's If-None-Match ETag matched.",
+	}, []string{"hit"})
+
+	OAuthDiscoveryFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "openshift",
+		Subsystem: "asset_server",
+		Name:      "oauth_discovery_failures_total",
+		Help:      "Counter of failures discovering OAuth or console configuration metadata during server startup.",
+	})
+
+	CSPViolationCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "openshift",
+		Subsystem: "asset_server",
+		Name:      "csp_violations_total",
+		Help:      "Counter of reported Content-Security-Policy violations broken out by violated directive, blocked URI host, and disposition.",
+	}, []string{"violated_directive", "blocked_uri_host", "disposition"})
+)
+
+func init() {
+	prometheus.MustRegister(AssetRequestCount)
+	prometheus.MustRegister(CompressionCount)
+	prometheus.MustRegister(HTML5FallbackCount)
+	prometheus.MustRegister(ETagCacheHitCount)
+	prometheus.MustRegister(OAuthDiscoveryFailureCount)
+	prometheus.MustRegister(CSPViolationCount)
+}
@@ -0,0 +1,98 @@
+// Package acme auto-provisions and renews TLS serving certificates through ACME (the
+// protocol used by Let's Encrypt, ZeroSSL, step-ca, and most other modern CAs), as an
+// alternative to an operator hand-managing certFile/keyFile on disk.
+package acme
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/openshift/api/webconsole/v1"
+	"github.com/openshift/origin-web-console-server/pkg/apis/webconsole/validation"
+)
+
+// NewTLSConfig returns a *tls.Config that auto-provisions and renews certificates for
+// config.Hostnames through ACME, caching them on disk at config.CachePath via
+// autocert.DirCache so a restart doesn't re-request them. The returned config also answers
+// the TLS-ALPN-01 challenge, so no separate listener or port-80 redirect is required.
+//
+// namedCertificates take precedence over ACME: a SNI name covered by one of them is served
+// from disk exactly as ValidateNamedCertificates already matches them, so an operator can
+// move a hostname from ACME to a hand-managed certificate (or back) without downtime.
+func NewTLSConfig(config v1.ACMEConfig, namedCertificates []v1.NamedCertificate) (*tls.Config, error) {
+	certs, err := loadNamedCertificates(namedCertificates)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(config.CachePath),
+		HostPolicy: autocert.HostWhitelist(config.Hostnames...),
+		Email:      config.Email,
+	}
+	if len(config.DirectoryURL) > 0 {
+		manager.Client = &acme.Client{DirectoryURL: config.DirectoryURL}
+	}
+
+	if len(config.EABKeyID) > 0 {
+		key, err := base64.RawURLEncoding.DecodeString(config.EABHMAC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACME external account binding HMAC key: %v", err)
+		}
+		manager.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: config.EABKeyID,
+			Key: key,
+		}
+	}
+
+	tlsConfig := manager.TLSConfig()
+	acmeGetCertificate := tlsConfig.GetCertificate
+	tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := certs.find(hello.ServerName); cert != nil {
+			return cert, nil
+		}
+		return acmeGetCertificate(hello)
+	}
+
+	return tlsConfig, nil
+}
+
+// namedCertificate pairs a loaded certificate with the names it was configured to serve.
+type namedCertificate struct {
+	names []string
+	cert  *tls.Certificate
+}
+
+type namedCertificates []namedCertificate
+
+// find returns the certificate configured to serve serverName, or nil if none of certs
+// covers it. ValidateNamedCertificates rejects a name repeated across certificates, but a
+// wildcard name and an exact name can both match serverName; the first match, in
+// configuration order, is returned.
+func (certs namedCertificates) find(serverName string) *tls.Certificate {
+	for _, nc := range certs {
+		for _, name := range nc.names {
+			if validation.HostnameMatches(serverName, name) {
+				return nc.cert
+			}
+		}
+	}
+	return nil
+}
+
+func loadNamedCertificates(configs []v1.NamedCertificate) (namedCertificates, error) {
+	certs := make(namedCertificates, 0, len(configs))
+	for _, nc := range configs {
+		cert, err := tls.LoadX509KeyPair(nc.CertFile, nc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading named certificate for %v: %v", nc.Names, err)
+		}
+		certs = append(certs, namedCertificate{names: nc.Names, cert: &cert})
+	}
+	return certs, nil
+}
@@ -0,0 +1,107 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/openshift/api/webconsole/v1"
+)
+
+// selfSignedCertificate returns a PEM-encoded cert/key pair with commonName as its subject
+// CommonName, suitable for exercising namedCertificates matching without a real CA.
+func selfSignedCertificate(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM
+}
+
+func writeTempFile(t *testing.T, contents []byte) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "acme-test-")
+	if err != nil {
+		t.Fatalf("error creating temp file: %v", err)
+	}
+	if _, err := f.Write(contents); err != nil {
+		t.Fatalf("error writing temp file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("error closing temp file: %v", err)
+	}
+	return f.Name()
+}
+
+func TestLoadNamedCertificatesFind(t *testing.T) {
+	certPEM, keyPEM := selfSignedCertificate(t, "console.example.com")
+	certFile := writeTempFile(t, certPEM)
+	keyFile := writeTempFile(t, keyPEM)
+
+	certs, err := loadNamedCertificates([]v1.NamedCertificate{
+		{CertFile: certFile, KeyFile: keyFile, Names: []string{"console.example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error loading named certificates: %v", err)
+	}
+
+	if cert := certs.find("console.example.com"); cert == nil {
+		t.Fatal("expected a named certificate match for console.example.com")
+	}
+	if cert := certs.find("other.example.com"); cert != nil {
+		t.Fatal("expected no named certificate match for other.example.com")
+	}
+}
+
+func TestNewTLSConfigPrefersNamedCertificates(t *testing.T) {
+	certPEM, keyPEM := selfSignedCertificate(t, "console.example.com")
+	certFile := writeTempFile(t, certPEM)
+	keyFile := writeTempFile(t, keyPEM)
+	cacheDir := t.TempDir()
+
+	tlsConfig, err := NewTLSConfig(
+		v1.ACMEConfig{
+			DirectoryURL: "https://acme.example.com/directory",
+			Email:        "admin@example.com",
+			Hostnames:    []string{"other.example.com"},
+			CachePath:    cacheDir,
+		},
+		[]v1.NamedCertificate{
+			{CertFile: certFile, KeyFile: keyFile, Names: []string{"console.example.com"}},
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error building TLS config: %v", err)
+	}
+
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "console.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	if cert == nil {
+		t.Fatal("expected the named certificate to be returned for console.example.com")
+	}
+}
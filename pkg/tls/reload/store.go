@@ -0,0 +1,84 @@
+// Package reload provides a TLS serving certificate store whose contents can be swapped
+// atomically after the listener is already accepting connections, so a rotated cert/key file
+// reaches new handshakes without racing ones already in flight or requiring the process to
+// restart.
+package reload
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/openshift/api/webconsole/v1"
+	"github.com/openshift/origin-web-console-server/pkg/apis/webconsole/validation"
+)
+
+// CertificateStore serves the current default and named (SNI) serving certificates to a TLS
+// handshake through GetCertificate. It is wired into SecureServingInfo.GetCertificate once at
+// startup; Reload loads a fresh set from disk and swaps it in atomically afterward, the same
+// way ConfigReloader already does for WebConsoleConfiguration, so rotating a static cert/key
+// no longer requires a pod restart.
+type CertificateStore struct {
+	current atomic.Value // holds *certificateSet
+}
+
+// certificateSet is one atomically-swappable snapshot of everything GetCertificate needs.
+type certificateSet struct {
+	defaultCert tls.Certificate
+	named       []namedCertificate
+}
+
+// namedCertificate pairs a loaded certificate with the SNI names it was configured to serve.
+type namedCertificate struct {
+	names []string
+	cert  *tls.Certificate
+}
+
+// NewCertificateStore builds a CertificateStore from certFile/keyFile and namedCertificates,
+// the same inputs SecureServingOptions.ApplyTo would otherwise load once into
+// SecureServingInfo.Cert/SNICerts and never revisit.
+func NewCertificateStore(certFile, keyFile string, namedCertificates []v1.NamedCertificate) (*CertificateStore, error) {
+	s := &CertificateStore{}
+	if err := s.Reload(certFile, keyFile, namedCertificates); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload loads certFile/keyFile and namedCertificates from disk and atomically swaps them in
+// as the set GetCertificate serves. A handshake already in progress against the previous set
+// finishes against it undisturbed; every handshake afterward sees the new one. If loading
+// fails, the previous set stays live and is returned as still current.
+func (s *CertificateStore) Reload(certFile, keyFile string, namedCertificates []v1.NamedCertificate) error {
+	defaultCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading serving certificate %s/%s: %v", certFile, keyFile, err)
+	}
+
+	named := make([]namedCertificate, 0, len(namedCertificates))
+	for _, nc := range namedCertificates {
+		cert, err := tls.LoadX509KeyPair(nc.CertFile, nc.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading named certificate for %v: %v", nc.Names, err)
+		}
+		named = append(named, namedCertificate{names: nc.Names, cert: &cert})
+	}
+
+	s.current.Store(&certificateSet{defaultCert: defaultCert, named: named})
+	return nil
+}
+
+// GetCertificate implements the signature SecureServingInfo.GetCertificate expects: the named
+// certificate matching info.ServerName, matched the same way acme.NewTLSConfig's static
+// certificate override does, or the default certificate if none matches.
+func (s *CertificateStore) GetCertificate(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.current.Load().(*certificateSet)
+	for _, nc := range set.named {
+		for _, name := range nc.names {
+			if validation.HostnameMatches(info.ServerName, name) {
+				return nc.cert, nil
+			}
+		}
+	}
+	return &set.defaultCert, nil
+}
@@ -0,0 +1,152 @@
+package reload
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/openshift/api/webconsole/v1"
+)
+
+// selfSignedCertificate returns a PEM-encoded cert/key pair with commonName as its subject
+// CommonName, suitable for exercising reload/SNI matching without touching a real CA.
+func selfSignedCertificate(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM
+}
+
+func writeTempFile(t *testing.T, contents []byte) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "reload-test-")
+	if err != nil {
+		t.Fatalf("error creating temp file: %v", err)
+	}
+	if _, err := f.Write(contents); err != nil {
+		t.Fatalf("error writing temp file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("error closing temp file: %v", err)
+	}
+	return f.Name()
+}
+
+func TestCertificateStoreGetCertificate(t *testing.T) {
+	defaultCertPEM, defaultKeyPEM := selfSignedCertificate(t, "default.example.com")
+	defaultCertFile := writeTempFile(t, defaultCertPEM)
+	defaultKeyFile := writeTempFile(t, defaultKeyPEM)
+
+	namedCertPEM, namedKeyPEM := selfSignedCertificate(t, "console.example.com")
+	namedCertFile := writeTempFile(t, namedCertPEM)
+	namedKeyFile := writeTempFile(t, namedKeyPEM)
+
+	store, err := NewCertificateStore(defaultCertFile, defaultKeyFile, []v1.NamedCertificate{
+		{CertFile: namedCertFile, KeyFile: namedKeyFile, Names: []string{"console.example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building certificate store: %v", err)
+	}
+
+	named, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "console.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	if named.Leaf == nil {
+		named.Leaf, _ = x509.ParseCertificate(named.Certificate[0])
+	}
+	if named.Leaf.Subject.CommonName != "console.example.com" {
+		t.Fatalf("expected the named certificate for console.example.com, got CN %q", named.Leaf.Subject.CommonName)
+	}
+
+	def, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "unmatched.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	if def.Leaf == nil {
+		def.Leaf, _ = x509.ParseCertificate(def.Certificate[0])
+	}
+	if def.Leaf.Subject.CommonName != "default.example.com" {
+		t.Fatalf("expected the default certificate for an unmatched name, got CN %q", def.Leaf.Subject.CommonName)
+	}
+}
+
+func TestCertificateStoreReload(t *testing.T) {
+	firstCertPEM, firstKeyPEM := selfSignedCertificate(t, "first.example.com")
+	firstCertFile := writeTempFile(t, firstCertPEM)
+	firstKeyFile := writeTempFile(t, firstKeyPEM)
+
+	store, err := NewCertificateStore(firstCertFile, firstKeyFile, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building certificate store: %v", err)
+	}
+
+	secondCertPEM, secondKeyPEM := selfSignedCertificate(t, "second.example.com")
+	secondCertFile := writeTempFile(t, secondCertPEM)
+	secondKeyFile := writeTempFile(t, secondKeyPEM)
+
+	if err := store.Reload(secondCertFile, secondKeyFile, nil); err != nil {
+		t.Fatalf("unexpected error reloading certificate store: %v", err)
+	}
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "anything.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if cert.Leaf.Subject.CommonName != "second.example.com" {
+		t.Fatalf("expected the reloaded certificate to be served, got CN %q", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestCertificateStoreReloadKeepsPreviousOnError(t *testing.T) {
+	certPEM, keyPEM := selfSignedCertificate(t, "first.example.com")
+	certFile := writeTempFile(t, certPEM)
+	keyFile := writeTempFile(t, keyPEM)
+
+	store, err := NewCertificateStore(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building certificate store: %v", err)
+	}
+
+	if err := store.Reload("/nonexistent/cert.pem", "/nonexistent/key.pem", nil); err == nil {
+		t.Fatal("expected an error reloading from nonexistent files")
+	}
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "anything.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if cert.Leaf.Subject.CommonName != "first.example.com" {
+		t.Fatalf("expected the previous certificate to still be served after a failed reload, got CN %q", cert.Leaf.Subject.CommonName)
+	}
+}